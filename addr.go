@@ -0,0 +1,142 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+var errInvalidAddr = errors.New("invalid address")
+
+// ErrFamilyMismatch is returned when an address of one family is used with
+// a set of the other, e.g. an IPv6 prefix with an inet set.
+var ErrFamilyMismatch = errors.New("address family does not match set")
+
+// checkFamily returns ErrFamilyMismatch, wrapped, unless a belongs to the
+// family of the set.
+func (s *IPSet) checkFamily(a netip.Addr) error {
+	a = a.Unmap()
+	if s.HashFamily == FamilyInet6 && a.Is4() || s.HashFamily != FamilyInet6 && a.Is6() {
+		return fmt.Errorf("%w: %s in %s set %s", ErrFamilyMismatch, a, s.HashFamily, s.Name)
+	}
+	return nil
+}
+
+// validAddr checks a is valid and of the family of the set.
+func (s *IPSet) validAddr(a netip.Addr) error {
+	if !a.IsValid() {
+		return errInvalidAddr
+	}
+	return s.checkFamily(a)
+}
+
+// validPrefix checks p is valid and of the family of the set.
+func (s *IPSet) validPrefix(p netip.Prefix) error {
+	if !p.IsValid() {
+		return errInvalidAddr
+	}
+	return s.checkFamily(p.Addr())
+}
+
+// ipNetPrefix converts n to a prefix; it is invalid for a nil or malformed n.
+func ipNetPrefix(n *net.IPNet) netip.Prefix {
+	if n == nil {
+		return netip.Prefix{}
+	}
+	a, ok := netip.AddrFromSlice(n.IP)
+	ones, bits := n.Mask.Size()
+	if !ok || bits == 0 {
+		return netip.Prefix{}
+	}
+	if bits == 32 {
+		a = a.Unmap()
+	}
+	return netip.PrefixFrom(a, ones)
+}
+
+// addrValue formats a as ipset expects it: without zone, and IPv4-mapped
+// IPv6 addresses as plain IPv4.
+func addrValue(a netip.Addr) string {
+	return a.WithZone("").Unmap().String()
+}
+
+// prefixValue formats p with its host bits cleared, and single addresses
+// without a mask.
+func prefixValue(p netip.Prefix) string {
+	a := p.Addr().WithZone("")
+	bits := p.Bits()
+	if a.Is4In6() && bits >= 96 {
+		a, bits = a.Unmap(), bits-96
+	}
+	p = netip.PrefixFrom(a, bits).Masked()
+	if p.IsSingleIP() {
+		return p.Addr().String()
+	}
+	return p.String()
+}
+
+// AddIP adds the address to the set, as Add does.
+func (s *IPSet) AddIP(a netip.Addr, timeout int) error {
+	if err := s.validAddr(a); err != nil {
+		return err
+	}
+	return s.Add(addrValue(a), timeout)
+}
+
+// DelIP deletes the address from the set.
+func (s *IPSet) DelIP(a netip.Addr) error {
+	if err := s.validAddr(a); err != nil {
+		return err
+	}
+	return s.Del(addrValue(a))
+}
+
+// TestIP reports whether the address is in the set.
+func (s *IPSet) TestIP(a netip.Addr) (bool, error) {
+	if err := s.validAddr(a); err != nil {
+		return false, err
+	}
+	return s.Test(addrValue(a))
+}
+
+// AddPrefix adds the network to the set, as Add does. Host bits are
+// cleared; a single address prefix is added as the plain address.
+func (s *IPSet) AddPrefix(p netip.Prefix, timeout int) error {
+	if err := s.validPrefix(p); err != nil {
+		return err
+	}
+	return s.Add(prefixValue(p), timeout)
+}
+
+// DelPrefix deletes the network from the set, with host bits cleared.
+func (s *IPSet) DelPrefix(p netip.Prefix) error {
+	if err := s.validPrefix(p); err != nil {
+		return err
+	}
+	return s.Del(prefixValue(p))
+}
+
+// TestPrefix reports whether the network, with host bits cleared, is in
+// the set.
+func (s *IPSet) TestPrefix(p netip.Prefix) (bool, error) {
+	if err := s.validPrefix(p); err != nil {
+		return false, err
+	}
+	return s.Test(prefixValue(p))
+}
+
+// AddIPNet adds the network to the set, as AddPrefix does.
+func (s *IPSet) AddIPNet(n *net.IPNet, timeout int) error {
+	return s.AddPrefix(ipNetPrefix(n), timeout)
+}
+
+// DelIPNet deletes the network from the set, as DelPrefix does.
+func (s *IPSet) DelIPNet(n *net.IPNet) error {
+	return s.DelPrefix(ipNetPrefix(n))
+}
+
+// TestIPNet reports whether the network is in the set, as TestPrefix does.
+func (s *IPSet) TestIPNet(n *net.IPNet) (bool, error) {
+	return s.TestPrefix(ipNetPrefix(n))
+}
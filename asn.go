@@ -0,0 +1,150 @@
+package go_ipset
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrefixSource resolves the prefixes announced by an autonomous system.
+type PrefixSource interface {
+	Prefixes(ctx context.Context, asn uint32) ([]netip.Prefix, error)
+}
+
+// RIPEstat resolves announced prefixes through the RIPEstat data API.
+type RIPEstat struct {
+	Client *http.Client
+	// BaseURL defaults to https://stat.ripe.net.
+	BaseURL string
+}
+
+func (r *RIPEstat) Prefixes(ctx context.Context, asn uint32) ([]netip.Prefix, error) {
+	base := r.BaseURL
+	if base == "" {
+		base = "https://stat.ripe.net"
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	u := base + "/data/announced-prefixes/data.json?resource=" + url.QueryEscape("AS"+strconv.FormatUint(uint64(asn), 10))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching prefixes of AS%d: %s", asn, resp.Status)
+	}
+	var doc struct {
+		Data struct {
+			Prefixes []struct {
+				Prefix string `json:"prefix"`
+			} `json:"prefixes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing prefixes of AS%d: %v", asn, err)
+	}
+	var ps []netip.Prefix
+	for _, p := range doc.Data.Prefixes {
+		if pfx, err := netip.ParsePrefix(p.Prefix); err == nil {
+			ps = append(ps, pfx.Masked())
+		}
+	}
+	return ps, nil
+}
+
+// Pfx2AS resolves announced prefixes from a local CAIDA pfx2as file, with
+// lines of network, prefix length and origin AS separated by whitespace.
+// Multi-origin prefixes (AS lists joined by _ or ,) count for every origin.
+type Pfx2AS struct {
+	Path string
+}
+
+func (f *Pfx2AS) Prefixes(ctx context.Context, asn uint32) ([]netip.Prefix, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	want := strconv.FormatUint(uint64(asn), 10)
+	var ps []netip.Prefix
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		match := false
+		for _, origin := range strings.FieldsFunc(fields[2], func(r rune) bool { return r == '_' || r == ',' }) {
+			if origin == want {
+				match = true
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if p, err := netip.ParsePrefix(fields[0] + "/" + fields[1]); err == nil {
+			ps = append(ps, p.Masked())
+		}
+	}
+	return ps, sc.Err()
+}
+
+// ASNSet fills a net set with the aggregated prefixes announced by a list
+// of autonomous systems.
+type ASNSet struct {
+	Set    *IPSet
+	ASNs   []uint32
+	Source PrefixSource
+}
+
+// Entries resolves and aggregates the prefixes of all ASNs, keeping those
+// of the family of the set. It can be used as a Scheduler Source.
+func (b *ASNSet) Entries(ctx context.Context) ([]string, error) {
+	var all []netip.Prefix
+	for _, asn := range b.ASNs {
+		ps, err := b.Source.Prefixes(ctx, asn)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range ps {
+			if p.Addr().Is6() == (b.Set.HashFamily == FamilyInet6) {
+				all = append(all, p)
+			}
+		}
+	}
+	var entries []string
+	for _, p := range AggregatePrefixes(all) {
+		entries = append(entries, p.String())
+	}
+	return entries, nil
+}
+
+// Build resolves the prefixes and atomically refreshes the set with them.
+func (b *ASNSet) Build(ctx context.Context) error {
+	entries, err := b.Entries(ctx)
+	if err != nil {
+		return err
+	}
+	return b.Set.Refresh(entries)
+}
+
+// Job returns a Scheduler job refreshing the set from the ASNs.
+func (b *ASNSet) Job(interval time.Duration) Job {
+	return Job{Set: b.Set, Source: b.Entries, Interval: interval}
+}
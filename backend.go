@@ -0,0 +1,113 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Backend carries out ipset commands for the package. Commands are given as
+// the arguments of the ipset utility, e.g. "add", "foo", "10.0.0.1", so that
+// every backend speaks the same language; restore reads its input from stdin.
+type Backend interface {
+	Run(stdin io.Reader, args ...string) (stdout, stderr []byte, err error)
+}
+
+// ErrUnsupported is returned, wrapped, for commands the backend in use
+// cannot carry out.
+var ErrUnsupported = errors.New("unsupported by ipset backend")
+
+// ErrUnsupportedPlatform is returned by every call on platforms other than
+// linux, unless a backend such as FakeBackend was set. It wraps
+// ErrUnsupported.
+var ErrUnsupportedPlatform = fmt.Errorf("%w: ipset requires linux", ErrUnsupported)
+
+var (
+	backendMu sync.Mutex
+	backend   Backend
+)
+
+// SetBackend makes the package run all ipset commands through b instead of
+// the default backend, which is the ipset utility when installed and
+// netlink otherwise.
+func SetBackend(b Backend) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	backend = b
+	ipsetVersion = nil
+}
+
+// ResetBackend drops the backend in use, so that the next command runs the
+// discovery of the default backend again.
+func ResetBackend() {
+	SetBackend(nil)
+}
+
+func initCheck() error {
+	_, err := currentBackend()
+	return err
+}
+
+// currentBackend returns the backend in use, discovering the default one
+// on first use.
+func currentBackend() (Backend, error) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if backend == nil {
+		if !supportedPlatform {
+			return nil, ErrUnsupportedPlatform
+		}
+		b, err := defaultBackend()
+		if err != nil {
+			return nil, err
+		}
+		backend = b
+	}
+	return backend, nil
+}
+
+// run runs an ipset command through the backend, retrying transient
+// failures as the retry policy allows, and records it in the metrics.
+func run(stdin io.Reader, args ...string) ([]byte, []byte, error) {
+	b, err := currentBackend()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkReadOnly(args); err != nil {
+		return nil, nil, err
+	}
+	p := currentRetryPolicy()
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		stdout, stderr, err := b.Run(stdin, args...)
+		if err == nil {
+			record(args, time.Since(start), nil)
+			return stdout, stderr, nil
+		}
+		if stdin != nil || attempt >= p.Attempts || !transient(stderr) {
+			err = kernelError(args, stderr, err)
+			record(args, time.Since(start), err)
+			return stdout, stderr, err
+		}
+		time.Sleep(p.Backoff << (attempt - 1))
+	}
+}
+
+// combinedOutput runs an ipset command and returns its stdout and stderr
+// together.
+func combinedOutput(args ...string) ([]byte, error) {
+	stdout, stderr, err := run(nil, args...)
+	return append(stdout, stderr...), err
+}
+
+// output runs an ipset command and returns its stdout, or its stderr when
+// it fails.
+func output(args ...string) ([]byte, error) {
+	stdout, stderr, err := run(nil, args...)
+	if err != nil {
+		return stderr, err
+	}
+	return stdout, nil
+}
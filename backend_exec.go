@@ -0,0 +1,118 @@
+//go:build !ipset_noexec
+
+package go_ipset
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Runner is the Backend running the ipset utility.
+type Runner struct {
+	// Path is the ipset binary.
+	Path string
+
+	// Wrapper is a command line ipset is run under for privileges, e.g.
+	// {"sudo", "-n"} or {"doas"}. Unless WrapReads is set, only commands
+	// changing kernel state are wrapped.
+	Wrapper   []string
+	WrapReads bool
+
+	// Env is the environment of ipset, as for exec.Cmd; nil inherits the
+	// environment of the process.
+	Env []string
+	// Dir is the working directory of ipset; empty means the current one.
+	Dir string
+	// ExtraArgs are passed before the arguments of every command, e.g.
+	// {"-!"}. Options changing the output, such as -q hiding errors, also
+	// hide them from this package.
+	ExtraArgs []string
+}
+
+// ExecBackend returns a backend running the ipset utility at path.
+func ExecBackend(path string) Backend {
+	return &Runner{Path: path}
+}
+
+func (r *Runner) Run(stdin io.Reader, args ...string) ([]byte, []byte, error) {
+	argv := append(append([]string{r.Path}, r.ExtraArgs...), args...)
+	wrapped := len(r.Wrapper) > 0 && (r.WrapReads || !readOnly(args))
+	if wrapped {
+		argv = append(append([]string(nil), r.Wrapper...), argv...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = stdin
+	cmd.Env = r.Env
+	cmd.Dir = r.Dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil && wrapped && !strings.HasPrefix(stderr.String(), "ipset") {
+		// ipset prefixes its own messages with its name
+		err = &WrapperError{Wrapper: r.Wrapper, Err: err, Stderr: strings.TrimSpace(stderr.String())}
+	} else if err != nil {
+		ke := &KernelError{Args: argv, ExitCode: -1, Stderr: stderr.String(), Err: err}
+		if cmd.ProcessState != nil {
+			ke.ExitCode = cmd.ProcessState.ExitCode()
+		}
+		err = ke
+	}
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// SetIpsetPath makes the package run the ipset utility at path, e.g. one
+// bundled outside PATH. The IPSET_PATH environment variable does the same
+// for the default backend.
+func SetIpsetPath(path string) error {
+	path, err := exec.LookPath(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errIpsetNotFound, err)
+	}
+	SetBackend(ExecBackend(path))
+	return nil
+}
+
+// SetIpsetWrapper makes the package run the ipset utility found as by the
+// default backend under wrapper for the commands changing kernel state,
+// e.g. SetIpsetWrapper("sudo", "-n").
+func SetIpsetWrapper(wrapper ...string) error {
+	if len(wrapper) == 0 {
+		return fmt.Errorf("error setting ipset wrapper: empty command")
+	}
+	if _, err := exec.LookPath(wrapper[0]); err != nil {
+		return &WrapperError{Wrapper: wrapper, Err: err}
+	}
+	name := "ipset"
+	if env := os.Getenv("IPSET_PATH"); env != "" {
+		name = env
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errIpsetNotFound, err)
+	}
+	SetBackend(&Runner{Path: path, Wrapper: wrapper})
+	return nil
+}
+
+// defaultBackend runs the ipset utility named by IPSET_PATH or found in
+// PATH, or talks netlink to the kernel when there is none.
+func defaultBackend() (Backend, error) {
+	name := "ipset"
+	if env := os.Getenv("IPSET_PATH"); env != "" {
+		name = env
+	}
+	path, err := exec.LookPath(name)
+	if err == nil {
+		return ExecBackend(path), nil
+	}
+	b, err := NetlinkBackend()
+	if err != nil {
+		return nil, fmt.Errorf("%w, %v", errIpsetNotFound, err)
+	}
+	return b, nil
+}
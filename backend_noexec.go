@@ -0,0 +1,9 @@
+//go:build ipset_noexec
+
+package go_ipset
+
+// defaultBackend talks netlink to the kernel; the ipset utility is never
+// run in builds with the ipset_noexec tag.
+func defaultBackend() (Backend, error) {
+	return NetlinkBackend()
+}
@@ -0,0 +1,229 @@
+package go_ipset
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BanManager keeps temporary bans in a set with the timeout extension,
+// recording the reason of each ban as its comment and evicting the oldest
+// bans when the set reaches its size limit.
+type BanManager struct {
+	Set *IPSet
+	// MaxSize caps the number of bans; 0 means the MaxElem of the set.
+	MaxSize int
+	// Escalation, when set, lengthens the bans of repeat offenders.
+	Escalation *Escalation
+
+	mu   sync.Mutex
+	bans map[string]banRecord
+}
+
+type banRecord struct {
+	at    time.Time
+	until time.Time // zero for permanent bans
+}
+
+// NewBanManager returns a BanManager for set. Reasons are only stored when
+// set has the comment extension.
+func NewBanManager(set *IPSet) *BanManager {
+	return &BanManager{Set: set, bans: make(map[string]banRecord)}
+}
+
+// Ban adds ip to the set for ttl, replacing the ttl and reason of an
+// existing ban; a zero ttl bans ip until Unban. If the set is full, the
+// oldest bans are lifted first. With Escalation set, ttl is the duration
+// of a first offense.
+func (m *BanManager) Ban(ip string, ttl time.Duration, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.forgetExpired()
+	if m.Escalation != nil {
+		var err error
+		if ttl, err = m.Escalation.apply(ip, ttl); err != nil {
+			return err
+		}
+	}
+	if _, ok := m.bans[ip]; !ok {
+		if err := m.makeRoom(); err != nil {
+			return err
+		}
+	}
+	e := Entry{Value: ip, Timeout: ttl, Permanent: ttl == 0}
+	if m.Set.Comment {
+		e.Comment = reason
+	}
+	if err := m.Set.AddEntry(e); err != nil {
+		return err
+	}
+	now := time.Now()
+	r := banRecord{at: now}
+	if ttl > 0 {
+		r.until = now.Add(ttl)
+	}
+	m.bans[ip] = r
+	return nil
+}
+
+// Unban lifts the ban on ip, if any.
+func (m *BanManager) Unban(ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.Set.Del(ip); err != nil {
+		return err
+	}
+	delete(m.bans, ip)
+	return nil
+}
+
+// IsBanned reports whether ip is currently banned.
+func (m *BanManager) IsBanned(ip string) (bool, error) {
+	return m.Set.Test(ip)
+}
+
+func (m *BanManager) maxSize() int {
+	if m.MaxSize > 0 {
+		return m.MaxSize
+	}
+	return m.Set.MaxElem
+}
+
+// makeRoom evicts the oldest bans so one more fits. Bans not made by this
+// manager count as oldest, in order of their remaining timeout.
+func (m *BanManager) makeRoom() error {
+	max := m.maxSize()
+	if max <= 0 {
+		return nil
+	}
+	n, err := m.Set.Len()
+	if err != nil || n < max {
+		return err
+	}
+	entries, err := m.Set.entries()
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		ri, oki := m.bans[entries[i].Value]
+		rj, okj := m.bans[entries[j].Value]
+		switch {
+		case oki && okj:
+			return ri.at.Before(rj.at)
+		case oki != okj:
+			return okj
+		}
+		return entries[i].Timeout < entries[j].Timeout
+	})
+	for _, e := range entries[:min(n-max+1, len(entries))] {
+		if err := m.Set.Del(e.Value); err != nil {
+			return err
+		}
+		delete(m.bans, e.Value)
+	}
+	return nil
+}
+
+// forgetExpired drops the records of bans the kernel has already expired.
+func (m *BanManager) forgetExpired() {
+	now := time.Now()
+	for ip, r := range m.bans {
+		if !r.until.IsZero() && now.After(r.until) {
+			delete(m.bans, ip)
+		}
+	}
+}
+
+// OffenseStore keeps track of offenses per source for Escalation.
+type OffenseStore interface {
+	// Record notes an offense by ip at now and returns the number of
+	// offenses by ip since now-window, this one included.
+	Record(ip string, now time.Time, window time.Duration) (int, error)
+}
+
+// Escalation multiplies the ban duration by Factor for every earlier
+// offense within Decay, up to Max.
+type Escalation struct {
+	// Factor must exceed 1 to lengthen bans; any other value, including
+	// the zero value, means 2.
+	Factor float64
+	// Max caps escalated durations; 0 caps them at MaxTimeout only.
+	Max time.Duration
+	// Decay is how long an offense counts; 0 means forever.
+	Decay time.Duration
+	// Store keeps the offenses; nil means an in-memory store.
+	Store OffenseStore
+
+	once sync.Once
+}
+
+func (e *Escalation) apply(ip string, ttl time.Duration) (time.Duration, error) {
+	e.once.Do(func() {
+		if e.Store == nil {
+			e.Store = NewMemoryOffenseStore()
+		}
+	})
+	n, err := e.Store.Record(ip, time.Now(), e.Decay)
+	if err != nil {
+		return 0, err
+	}
+	factor := e.Factor
+	if factor <= 1 {
+		factor = 2
+	}
+	d := float64(ttl) * math.Pow(factor, float64(n-1))
+	if e.Max > 0 && d > float64(e.Max) {
+		return e.Max, nil
+	}
+	if d > float64(MaxTimeout) {
+		return MaxTimeout, nil
+	}
+	return time.Duration(d), nil
+}
+
+// MemoryOffenseStore is an OffenseStore held in memory. Addresses whose
+// offenses have all decayed are evicted, and offenses that never decay are
+// only counted, so memory stays bounded by the recent offenders.
+type MemoryOffenseStore struct {
+	mu       sync.Mutex
+	offenses map[string][]time.Time
+	// counts holds the offenses recorded without a window, which never
+	// decay.
+	counts map[string]int
+	swept  time.Time
+}
+
+// NewMemoryOffenseStore returns an empty MemoryOffenseStore.
+func NewMemoryOffenseStore() *MemoryOffenseStore {
+	return &MemoryOffenseStore{offenses: make(map[string][]time.Time), counts: make(map[string]int)}
+}
+
+func (st *MemoryOffenseStore) Record(ip string, now time.Time, window time.Duration) (int, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if window <= 0 {
+		st.counts[ip]++
+		return st.counts[ip], nil
+	}
+	times := append(st.offenses[ip], now)
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > window {
+		i++
+	}
+	st.offenses[ip] = times[i:]
+	if now.Sub(st.swept) > window {
+		st.sweep(now, window)
+	}
+	return len(st.offenses[ip]), nil
+}
+
+// sweep evicts the addresses whose offenses have all decayed.
+func (st *MemoryOffenseStore) sweep(now time.Time, window time.Duration) {
+	for ip, times := range st.offenses {
+		if now.Sub(times[len(times)-1]) > window {
+			delete(st.offenses, ip)
+		}
+	}
+	st.swept = now
+}
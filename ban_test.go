@@ -0,0 +1,29 @@
+package go_ipset
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEscalationRepeatBan(t *testing.T) {
+	SetBackend(FakeBackend())
+	t.Cleanup(ResetBackend)
+	s, err := New("bans", TypeHashIP, &Params{Create: true, Timeout: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewBanManager(s)
+	m.Escalation = &Escalation{}
+	for i, want := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second} {
+		if err := m.Ban("192.0.2.1", 10*time.Second, "scan"); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := s.entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Timeout != want {
+			t.Errorf("offense %d: entries %+v, want timeout %v", i+1, entries, want)
+		}
+	}
+}
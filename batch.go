@@ -0,0 +1,43 @@
+package go_ipset
+
+import "errors"
+
+// Failure is one failed item of a batch operation: an entry, or a set for
+// operations on several sets.
+type Failure struct {
+	Item string
+	Err  error
+}
+
+// BatchError reports every failure of a batch operation. It wraps the
+// errors of all failures, so errors.Is and errors.As consider each of them.
+type BatchError struct {
+	Failures []Failure
+}
+
+func (e *BatchError) Error() string {
+	return errors.Join(e.Unwrap()...).Error()
+}
+
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// add records a failure of item unless err is nil.
+func (e *BatchError) add(item string, err error) {
+	if err != nil {
+		e.Failures = append(e.Failures, Failure{Item: item, Err: err})
+	}
+}
+
+// err returns e, or nil when nothing failed.
+func (e *BatchError) err() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,96 @@
+package go_ipset
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cache mirrors the members of a set in memory for lookups that can
+// tolerate slightly stale answers. It follows the changes made through the
+// handle and is reloaded from the kernel by Reload or Run, which also
+// catches expired entries and changes made by others.
+type Cache struct {
+	Set *IPSet
+	// MaxAge is how long after a reload the mirror counts as fresh.
+	MaxAge time.Duration
+	// OnError receives reload errors of Run; it may be nil.
+	OnError func(error)
+
+	mu sync.RWMutex
+	// members maps the canonical members to false for nomatch entries.
+	members map[string]bool
+	loaded  time.Time
+}
+
+// NewCache returns a cache of s, which it keeps current with the changes
+// made through s. The cache is empty until the first Reload.
+func NewCache(s *IPSet, maxAge time.Duration) *Cache {
+	c := &Cache{Set: s, MaxAge: maxAge}
+	s.OnChange(c.apply)
+	return c
+}
+
+// Reload replaces the mirror with the live content of the set.
+func (c *Cache) Reload() error {
+	entries, err := c.Set.entries()
+	if err != nil {
+		return err
+	}
+	m := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		m[canonical(c.Set.HashType, e.Value)] = !e.NoMatch
+	}
+	c.mu.Lock()
+	c.members = m
+	c.loaded = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// Run reloads the cache every MaxAge until ctx is done. MaxAge must be
+// positive.
+func (c *Cache) Run(ctx context.Context) error {
+	if c.MaxAge <= 0 {
+		return fmt.Errorf("cache of set %s: MaxAge %v is not positive", c.Set.Name, c.MaxAge)
+	}
+	t := time.NewTicker(c.MaxAge)
+	defer t.Stop()
+	for {
+		if err := c.Reload(); err != nil && c.OnError != nil {
+			c.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Cache) apply(added, deleted []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.members == nil {
+		return
+	}
+	for _, v := range deleted {
+		delete(c.members, canonical(c.Set.HashType, v))
+	}
+	for _, v := range added {
+		c.members[canonical(c.Set.HashType, v)] = true
+	}
+}
+
+// ContainsLocal reports whether entry is in the mirror of the set, and
+// whether the mirror was reloaded within MaxAge. In hash:net sets an
+// address or network also matches the networks containing it, unless the
+// most specific one is a nomatch entry. Entries added through the handle
+// count as matching until the next reload, even with NoMatch.
+func (c *Cache) ContainsLocal(entry string) (member, fresh bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fresh = !c.loaded.IsZero() && time.Since(c.loaded) <= c.MaxAge
+	return matchMember(c.Set.HashType, c.members, entry), fresh
+}
@@ -0,0 +1,58 @@
+package go_ipset
+
+import "strings"
+
+// CloneTo creates newName with the same header as s and copies all members
+// into it. keep selects whether remaining timeouts and counters are copied
+// too; otherwise members start over with the set defaults.
+func (s *IPSet) CloneTo(newName string, keep Keep) (*IPSet, error) {
+	entries, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+	clone := &IPSet{
+		Name:       newName,
+		HashType:   s.HashType,
+		HashFamily: s.HashFamily,
+		HashSize:   s.HashSize,
+		MaxElem:    s.MaxElem,
+		Timeout:    s.Timeout,
+		Comment:    s.Comment,
+		Counters:   s.Counters,
+		TimeoutExt: s.TimeoutExt,
+		Defaults:   s.Defaults,
+		DryRun:     s.DryRun,
+		Locker:     s.Locker,
+		Pacing:     s.Pacing,
+		Staging:    s.Staging,
+		ReadOnly:   s.ReadOnly,
+		Protected:  s.Protected,
+		Owner:      s.Owner,
+		extra:      s.extra,
+
+		defaultMaxElem: s.defaultMaxElem,
+	}
+	if err := clone.create(newName); err != nil {
+		return nil, err
+	}
+	// the copy is loaded into a staging set and swapped in, so newName
+	// never shows partial content
+	err = clone.replace(func(tempName string) ([]Entry, error) {
+		var b strings.Builder
+		for i := range entries {
+			e := &entries[i]
+			if keep&KeepTimeouts == 0 {
+				e.Timeout, e.Permanent = 0, false
+			}
+			if keep&KeepCounters == 0 {
+				e.Packets, e.Bytes = 0, 0
+			}
+			b.WriteString(addLine(tempName, *e) + "\n")
+		}
+		return entries, restore(clone.DryRun, strings.NewReader(b.String()))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
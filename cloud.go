@@ -0,0 +1,279 @@
+package go_ipset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// CloudRange is a published address range of a cloud or CDN provider.
+type CloudRange struct {
+	Prefix  netip.Prefix
+	Service string
+	Region  string
+}
+
+// ErrNoCloudRanges is returned by CloudImport when no published range of
+// the family of its set passes the filters, e.g. after a format change of
+// the provider or with a misspelled region, which would otherwise empty
+// the set.
+var ErrNoCloudRanges = errors.New("no cloud ranges match")
+
+// CloudProvider fetches the published ranges of a provider.
+type CloudProvider interface {
+	Ranges(ctx context.Context) ([]CloudRange, error)
+}
+
+// Default locations of the provider range lists. Azure publishes its
+// service tags under a URL that changes weekly, so it has no default.
+const (
+	AWSRangesURL         = "https://ip-ranges.amazonaws.com/ip-ranges.json"
+	GCPRangesURL         = "https://www.gstatic.com/ipranges/cloud.json"
+	CloudflareRangesURL  = "https://www.cloudflare.com/ips-v4"
+	Cloudflare6RangesURL = "https://www.cloudflare.com/ips-v6"
+	FastlyRangesURL      = "https://api.fastly.com/public-ip-list"
+)
+
+// AWSRanges reads the AWS ip-ranges.json document.
+type AWSRanges struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *AWSRanges) Ranges(ctx context.Context) ([]CloudRange, error) {
+	var doc struct {
+		Prefixes []struct {
+			Prefix  string `json:"ip_prefix"`
+			Region  string `json:"region"`
+			Service string `json:"service"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			Prefix  string `json:"ipv6_prefix"`
+			Region  string `json:"region"`
+			Service string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := getJSON(ctx, p.Client, orDefault(p.URL, AWSRangesURL), &doc); err != nil {
+		return nil, err
+	}
+	var ranges []CloudRange
+	for _, r := range doc.Prefixes {
+		ranges = appendRange(ranges, r.Prefix, r.Service, r.Region)
+	}
+	for _, r := range doc.IPv6Prefixes {
+		ranges = appendRange(ranges, r.Prefix, r.Service, r.Region)
+	}
+	return ranges, nil
+}
+
+// GCPRanges reads the Google Cloud cloud.json document. Its scope is
+// reported as the region.
+type GCPRanges struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *GCPRanges) Ranges(ctx context.Context) ([]CloudRange, error) {
+	var doc struct {
+		Prefixes []struct {
+			IPv4    string `json:"ipv4Prefix"`
+			IPv6    string `json:"ipv6Prefix"`
+			Service string `json:"service"`
+			Scope   string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := getJSON(ctx, p.Client, orDefault(p.URL, GCPRangesURL), &doc); err != nil {
+		return nil, err
+	}
+	var ranges []CloudRange
+	for _, r := range doc.Prefixes {
+		ranges = appendRange(ranges, r.IPv4+r.IPv6, r.Service, r.Scope)
+	}
+	return ranges, nil
+}
+
+// AzureRanges reads an Azure service tags document. Service is the system
+// service of a tag, or the tag name when it has none.
+type AzureRanges struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *AzureRanges) Ranges(ctx context.Context) ([]CloudRange, error) {
+	if p.URL == "" {
+		return nil, fmt.Errorf("azure service tags URL not set")
+	}
+	var doc struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				SystemService   string   `json:"systemService"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := getJSON(ctx, p.Client, p.URL, &doc); err != nil {
+		return nil, err
+	}
+	var ranges []CloudRange
+	for _, v := range doc.Values {
+		service := orDefault(v.Properties.SystemService, v.Name)
+		for _, prefix := range v.Properties.AddressPrefixes {
+			ranges = appendRange(ranges, prefix, service, v.Properties.Region)
+		}
+	}
+	return ranges, nil
+}
+
+// CloudflareRanges reads Cloudflare's plain text IPv4 and IPv6 lists.
+type CloudflareRanges struct {
+	URLs   []string
+	Client *http.Client
+}
+
+func (p *CloudflareRanges) Ranges(ctx context.Context) ([]CloudRange, error) {
+	urls := p.URLs
+	if len(urls) == 0 {
+		urls = []string{CloudflareRangesURL, Cloudflare6RangesURL}
+	}
+	var ranges []CloudRange
+	for _, u := range urls {
+		data, err := httpGet(ctx, p.Client, u)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Fields(string(data)) {
+			ranges = appendRange(ranges, line, "cloudflare", "")
+		}
+	}
+	return ranges, nil
+}
+
+// FastlyRanges reads Fastly's public IP list.
+type FastlyRanges struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *FastlyRanges) Ranges(ctx context.Context) ([]CloudRange, error) {
+	var doc struct {
+		Addresses     []string `json:"addresses"`
+		IPv6Addresses []string `json:"ipv6_addresses"`
+	}
+	if err := getJSON(ctx, p.Client, orDefault(p.URL, FastlyRangesURL), &doc); err != nil {
+		return nil, err
+	}
+	var ranges []CloudRange
+	for _, a := range append(doc.Addresses, doc.IPv6Addresses...) {
+		ranges = appendRange(ranges, a, "fastly", "")
+	}
+	return ranges, nil
+}
+
+// CloudImport fills a net set with the ranges of a provider, optionally
+// limited to some services and regions (matched case-insensitively).
+type CloudImport struct {
+	Set      *IPSet
+	Provider CloudProvider
+	Services []string
+	Regions  []string
+}
+
+// Entries fetches and filters the ranges, keeping those of the family of
+// the set, and aggregates them. It fails with ErrNoCloudRanges when no
+// range is left. It can be used as a Scheduler Source.
+func (c *CloudImport) Entries(ctx context.Context) ([]string, error) {
+	ranges, err := c.Provider.Ranges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ps []netip.Prefix
+	for _, r := range ranges {
+		if r.Prefix.Addr().Is6() != (c.Set.HashFamily == FamilyInet6) {
+			continue
+		}
+		if matchAny(c.Services, r.Service) && matchAny(c.Regions, r.Region) {
+			ps = append(ps, r.Prefix)
+		}
+	}
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("%w: %d ranges fetched, none for set %s", ErrNoCloudRanges, len(ranges), c.Set.Name)
+	}
+	var entries []string
+	for _, p := range AggregatePrefixes(ps) {
+		entries = append(entries, p.String())
+	}
+	return entries, nil
+}
+
+// Refresh fetches the ranges and atomically refreshes the set with them.
+func (c *CloudImport) Refresh(ctx context.Context) error {
+	entries, err := c.Entries(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Set.Refresh(entries)
+}
+
+func matchAny(filter []string, v string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		if strings.EqualFold(f, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendRange(ranges []CloudRange, prefix, service, region string) []CloudRange {
+	p, ok := parsePrefix(strings.TrimSpace(prefix))
+	if !ok {
+		return ranges
+	}
+	return append(ranges, CloudRange{Prefix: p, Service: service, Region: region})
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func httpGet(ctx context.Context, client *http.Client, u string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v interface{}) error {
+	data, err := httpGet(ctx, client, u)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s: %v", u, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package go_ipset
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newFakeSet(t *testing.T, name string) *IPSet {
+	t.Helper()
+	SetBackend(FakeBackend())
+	t.Cleanup(ResetBackend)
+	s, err := New(name, TypeHashIP, &Params{Create: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestConcurrentAddDelRefresh(t *testing.T) {
+	s := newFakeSet(t, "race")
+	base := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				entry := fmt.Sprintf("10.%d.0.%d", w, i)
+				if err := s.Add(entry, 0); err != nil {
+					errs <- err
+					return
+				}
+				if err := DeleteEntry(s, entry); err != nil {
+					errs <- err
+					return
+				}
+				if err := EnsureEntry(s, entry); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := s.Refresh(base); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	for _, entry := range base {
+		ok, err := s.Test(entry)
+		if err != nil || !ok {
+			t.Errorf("%s missing after refreshes: %v", entry, err)
+		}
+	}
+}
+
+// pausingBackend holds up the creation of staging sets until released.
+type pausingBackend struct {
+	Backend
+	staged  chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *pausingBackend) Run(stdin io.Reader, args ...string) ([]byte, []byte, error) {
+	if len(args) > 1 && args[0] == "create" && strings.HasSuffix(args[1], "-temp") {
+		b.once.Do(func() {
+			close(b.staged)
+			<-b.release
+		})
+	}
+	return b.Backend.Run(stdin, args...)
+}
+
+func TestMutationsDuringRefreshSurviveSwap(t *testing.T) {
+	s := newFakeSet(t, "journal")
+	if err := s.Add("192.0.2.9", 0); err != nil {
+		t.Fatal(err)
+	}
+	b := &pausingBackend{Backend: FakeBackend(), staged: make(chan struct{}), release: make(chan struct{})}
+	SetBackend(b)
+	if _, err := New("journal", TypeHashIP, &Params{Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Refresh([]string{"192.0.2.1", "192.0.2.2"})
+	}()
+	<-b.staged
+	for _, err := range []error{
+		s.Add("198.51.100.1", 0),
+		EnsureEntry(s, "198.51.100.2"),
+		s.Del("192.0.2.1"),
+		DeleteEntry(s, "192.0.2.2"),
+	} {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	close(b.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"198.51.100.1": true,
+		"198.51.100.2": true,
+		"192.0.2.1":    false,
+		"192.0.2.2":    false,
+	}
+	for entry, present := range want {
+		ok, err := s.Test(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != present {
+			t.Errorf("%s present = %v after swap, want %v", entry, ok, present)
+		}
+	}
+}
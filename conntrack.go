@@ -0,0 +1,73 @@
+package go_ipset
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ConntrackFlush selects when connection tracking entries are flushed, so
+// that established flows are cut as soon as a set changes.
+type ConntrackFlush int
+
+const (
+	// ConntrackOnAdd flushes after adding an entry, e.g. for block sets.
+	ConntrackOnAdd ConntrackFlush = 1 << iota
+	// ConntrackOnDel flushes after deleting an entry, e.g. for allow sets.
+	ConntrackOnDel
+)
+
+var (
+	conntrackMu   sync.Mutex
+	conntrackPath string
+)
+
+// dropConntrack flushes the tracked connections of entry after it was added
+// or deleted. The change of the set stands either way, so a failure is
+// reported as a warning, to the OnWarning hooks and the warning handler,
+// rather than as an error.
+func (s *IPSet) dropConntrack(entry string) {
+	if err := s.flushConntrack(entry); err != nil {
+		s.notifyWarnings(warnings([]string{"conntrack", "-D", entry}, []byte(err.Error())))
+	}
+}
+
+// flushConntrack deletes the tracked connections from and to the leading
+// address or network of entry using the conntrack tool.
+func (s *IPSet) flushConntrack(entry string) error {
+	if activePlan(s.DryRun) != nil {
+		return nil
+	}
+	conntrackMu.Lock()
+	if conntrackPath == "" {
+		conntrackPath, _ = exec.LookPath("conntrack")
+	}
+	path := conntrackPath
+	conntrackMu.Unlock()
+	if path == "" {
+		return fmt.Errorf("conntrack utility not found")
+	}
+	p, ok := parsePrefix(strings.SplitN(entry, ",", 2)[0])
+	if !ok {
+		return fmt.Errorf("error flushing conntrack for %s: not an address", entry)
+	}
+	family := "ipv4"
+	if p.Addr().Is6() {
+		family = "ipv6"
+	}
+	for _, dir := range [][2]string{{"--src", "--mask-src"}, {"--dst", "--mask-dst"}} {
+		args := []string{"-D", "-f", family, dir[0], p.Addr().String()}
+		if !p.IsSingleIP() {
+			mask := net.IP(net.CIDRMask(p.Bits(), p.Addr().BitLen()))
+			args = append(args, dir[1], mask.String())
+		}
+		out, err := exec.Command(path, args...).CombinedOutput()
+		// conntrack exits with 1 when nothing matched
+		if err != nil && !strings.Contains(string(out), "0 flow entries") {
+			return fmt.Errorf("error flushing conntrack for %s: %v (%s)", entry, err, out)
+		}
+	}
+	return nil
+}
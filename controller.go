@@ -0,0 +1,321 @@
+package go_ipset
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// ErrSetReferenced is returned for sets that cannot be torn down because
+// iptables rules or list:set sets still reference them.
+var ErrSetReferenced = errors.New("set is referenced")
+
+// ErrHeaderChanged is returned by Apply for a set whose type or family
+// changed while something outside the controller still references it: the
+// set cannot be swapped with one of the new header, nor be recreated, until
+// the references are gone.
+var ErrHeaderChanged = errors.New("set type or family changed")
+
+// Config is the desired state of the sets managed by a Controller.
+type Config struct {
+	Sets []SetSpec `json:"sets"`
+}
+
+// ConfigFile returns a loader reading a Config from the file at path, either
+// as JSON or in the ipset save format.
+func ConfigFile(path string) func() (*Config, error) {
+	return func() (*Config, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var cfg Config
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+			err = json.Unmarshal(data, &cfg)
+		} else {
+			cfg.Sets, err = ParseRestore(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &cfg, nil
+	}
+}
+
+// Controller converges the kernel to a declarative Config: it creates and
+// fills the sets of the config and tears down the sets it created earlier
+// that the config no longer lists.
+type Controller struct {
+	// Load returns the config applied by Reload.
+	Load func() (*Config, error)
+	// OnError receives the errors of reloads triggered by SIGHUP in Run;
+	// it may be nil.
+	OnError func(error)
+	// Systemd makes Run report readiness and reloads to systemd.
+	Systemd bool
+
+	// Bindings are installed for every set of the config, with Set filled
+	// in, and removed before the set is torn down.
+	Bindings []RuleBinding
+	// Prune makes Apply also tear down the sets Owns reports as belonging
+	// to the application that are missing from the config, e.g. leftovers
+	// of removed features. Namer.Owns fits Owns.
+	Prune bool
+	Owns  func(name string) bool
+	// Registry, when set, records the sets Apply creates and forgets the
+	// ones it tears down; with Prune, the recorded sets count as owned
+	// too, so sets created by hand are never pruned.
+	Registry *OwnerFile
+
+	mu   sync.Mutex
+	sets map[string]*IPSet
+}
+
+// NewController returns a Controller applying the configs returned by load.
+func NewController(load func() (*Config, error)) *Controller {
+	return &Controller{Load: load, sets: make(map[string]*IPSet)}
+}
+
+// Get returns the handle of a managed set.
+func (c *Controller) Get(name string) (*IPSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.sets[name]
+	return s, ok
+}
+
+// Reload loads the config and applies it.
+func (c *Controller) Reload() error {
+	cfg, err := c.Load()
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+	return c.Apply(cfg)
+}
+
+// Apply converges to cfg. Sets are created when missing and atomically
+// refreshed with their entries; a changed header is applied by the swap of
+// the refresh, except for a changed type or family, which ipset cannot
+// swap: such a set is torn down and created anew, see ErrHeaderChanged.
+// Managed sets missing from cfg are destroyed, unless they are still
+// referenced, in which case they stay managed and fail with
+// ErrSetReferenced until a later Apply succeeds. Failures are reported in
+// a *BatchError keyed by set name.
+func (c *Controller) Apply(cfg *Config) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sets == nil {
+		c.sets = make(map[string]*IPSet)
+	}
+	var batch BatchError
+	wanted := make(map[string]bool, len(cfg.Sets))
+	for i := range cfg.Sets {
+		sp := &cfg.Sets[i]
+		wanted[sp.Name] = true
+		s, err := c.converge(sp)
+		if err != nil {
+			batch.add(sp.Name, err)
+			continue
+		}
+		c.sets[sp.Name] = s
+		for _, b := range c.bindings(s) {
+			batch.add(sp.Name, b.Install())
+		}
+	}
+	names, err := c.prunable(wanted)
+	if err != nil {
+		batch.add("", err)
+	}
+	for _, name := range names {
+		s, ok := c.sets[name]
+		if !ok {
+			s = &IPSet{Name: name}
+		}
+		if err := c.remove(s); err != nil {
+			batch.add(name, err)
+			continue
+		}
+		delete(c.sets, name)
+		if c.Registry != nil {
+			batch.add(name, c.Registry.Remove(name))
+		}
+	}
+	return batch.err()
+}
+
+// Prunable previews the sets Apply would tear down for cfg: managed sets
+// missing from it and, with Prune, the unlisted sets of the application.
+func (c *Controller) Prunable(cfg *Config) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wanted := make(map[string]bool, len(cfg.Sets))
+	for _, sp := range cfg.Sets {
+		wanted[sp.Name] = true
+	}
+	return c.prunable(wanted)
+}
+
+func (c *Controller) prunable(wanted map[string]bool) ([]string, error) {
+	var names []string
+	for name := range c.sets {
+		if !wanted[name] {
+			names = append(names, name)
+		}
+	}
+	var err error
+	if c.Prune && (c.Owns != nil || c.Registry != nil) {
+		var all []string
+		all, err = ListNames()
+		for _, name := range all {
+			if c.owns(name) && !wanted[name] && c.sets[name] == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+	return names, err
+}
+
+func (c *Controller) owns(name string) bool {
+	return (c.Owns != nil && c.Owns(name)) || (c.Registry != nil && c.Registry.Owns(name))
+}
+
+// bindings returns the bindings of s made from the templates.
+func (c *Controller) bindings(s *IPSet) []*RuleBinding {
+	bs := make([]*RuleBinding, len(c.Bindings))
+	for i, b := range c.Bindings {
+		b.Set = s
+		bs[i] = &b
+	}
+	return bs
+}
+
+// remove removes the bindings of s and tears it down.
+func (c *Controller) remove(s *IPSet) error {
+	for _, b := range c.bindings(s) {
+		if !b.Installed() {
+			continue
+		}
+		if err := b.Remove(); err != nil {
+			return err
+		}
+	}
+	return teardown(s)
+}
+
+// converge brings the set of sp to its spec, reusing the managed handle
+// unless the header changed.
+func (c *Controller) converge(sp *SetSpec) (*IPSet, error) {
+	h, err := sp.handle()
+	if err != nil {
+		return nil, err
+	}
+	s, ok := c.sets[sp.Name]
+	if !ok || !sameHeader(s, h) {
+		s = h
+	}
+	exists, err := s.Exists()
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		if exists, err = c.recreatable(s); err != nil {
+			return nil, err
+		}
+	}
+	if !exists {
+		if err := s.create(s.Name); err != nil {
+			return nil, err
+		}
+		if c.Registry != nil {
+			if err := c.Registry.Add(s.Name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.RefreshEntries(sp.Entries); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// recreatable tears down the live set of s when its type or family differ
+// from s, along with the bindings of the controller, and reports whether
+// the set still exists.
+func (c *Controller) recreatable(s *IPSet) (bool, error) {
+	info, err := s.Stats()
+	if err != nil {
+		return false, err
+	}
+	if info.Type == s.HashType && info.Family == s.HashFamily {
+		return true, nil
+	}
+	// the bindings of the live set are in the tables of its family
+	live := &IPSet{Name: s.Name, HashType: info.Type, HashFamily: info.Family}
+	if err := c.remove(live); err != nil {
+		return false, fmt.Errorf("%w: %s is %s %s, config wants %s %s: %w", ErrHeaderChanged, s.Name, info.Type, info.Family, s.HashType, s.HashFamily, err)
+	}
+	return false, nil
+}
+
+func sameHeader(a, b *IPSet) bool {
+	return a.HashType == b.HashType && a.HashFamily == b.HashFamily &&
+		a.HashSize == b.HashSize && a.MaxElem == b.MaxElem &&
+		a.Timeout == b.Timeout && a.TimeoutExt == b.TimeoutExt && a.Comment == b.Comment &&
+		a.Counters == b.Counters && slices.Equal(a.extra, b.extra)
+}
+
+// teardown destroys s unless something still references it.
+func teardown(s *IPSet) error {
+	exists, err := s.Exists()
+	if err != nil || !exists {
+		return err
+	}
+	info, err := s.Stats()
+	if err != nil {
+		return err
+	}
+	if info.References > 0 {
+		return fmt.Errorf("%w: %s has %d references", ErrSetReferenced, s.Name, info.References)
+	}
+	return s.Destroy()
+}
+
+// Run applies the config and then reloads it on every SIGHUP until ctx is
+// done. Errors of the first load are returned, later ones passed to
+// OnError.
+func (c *Controller) Run(ctx context.Context) error {
+	if err := c.Reload(); err != nil {
+		return err
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	if c.Systemd {
+		SdNotify("READY=1")
+		defer SdNotify("STOPPING=1")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-hup:
+			if c.Systemd {
+				SdNotify("RELOADING=1")
+			}
+			if err := c.Reload(); err != nil && c.OnError != nil {
+				c.OnError(err)
+			}
+			if c.Systemd {
+				SdNotify("READY=1")
+			}
+		}
+	}
+}
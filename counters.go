@@ -0,0 +1,90 @@
+package go_ipset
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Counter holds the packet and byte counters of an entry.
+type Counter struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// EntryCounters returns the counters of every entry of a set with the counters
+// extension, keyed by entry.
+func (s *IPSet) EntryCounters() (map[string]Counter, error) {
+	entries, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+	counters := make(map[string]Counter, len(entries))
+	for _, e := range entries {
+		counters[e.Value] = Counter{Packets: e.Packets, Bytes: e.Bytes}
+	}
+	return counters, nil
+}
+
+// CounterDelta returns how much each entry of cur has counted since prev.
+// Entries new in cur, or whose counters went down because they were
+// re-added, count from zero.
+func CounterDelta(prev, cur map[string]Counter) map[string]Counter {
+	delta := make(map[string]Counter, len(cur))
+	for entry, c := range cur {
+		p, ok := prev[entry]
+		if !ok || c.Packets < p.Packets || c.Bytes < p.Bytes {
+			delta[entry] = c
+			continue
+		}
+		delta[entry] = Counter{Packets: c.Packets - p.Packets, Bytes: c.Bytes - p.Bytes}
+	}
+	return delta
+}
+
+// ResetCounters zeroes the counters of entry by re-adding it, keeping its
+// remaining timeout and comment.
+func (s *IPSet) ResetCounters(entry string) error {
+	entries, err := s.entries()
+	if err != nil {
+		return err
+	}
+	c := canonical(s.HashType, entry)
+	for _, e := range entries {
+		if canonical(s.HashType, e.Value) != c {
+			continue
+		}
+		args := append([]string{"add", s.Name, e.Value}, resetArgs(e)...)
+		out, err := s.mutateShared(append(args, "-exist")...)
+		if err != nil {
+			return fmt.Errorf("error resetting counters of entry %s: %w (%s)", entry, err, out)
+		}
+		return nil
+	}
+	return fmt.Errorf("error resetting counters of entry %s: not in set %s", entry, s.Name)
+}
+
+// ResetAllCounters zeroes the counters of every entry in one restore run,
+// keeping remaining timeouts and comments.
+func (s *IPSet) ResetAllCounters() error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	entries, err := s.entries()
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		e.Packets, e.Bytes = 0, 0
+		b.WriteString(addLine(s.Name, e) + " packets 0 bytes 0\n")
+	}
+	if err := restore(s.DryRun, strings.NewReader(b.String()), "-exist"); err != nil {
+		return fmt.Errorf("error resetting counters of set %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+func resetArgs(e Entry) []string {
+	e.Packets, e.Bytes = 0, 0
+	return append(e.args(), "packets", "0", "bytes", "0")
+}
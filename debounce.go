@@ -0,0 +1,123 @@
+package go_ipset
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Debouncer coalesces refresh triggers arriving in quick succession, e.g.
+// from a file watcher, a timer and a manual reload, into a single run of
+// Refresh once no trigger arrived for Interval.
+type Debouncer struct {
+	Interval time.Duration
+	// MaxDelay bounds how long a stream of triggers may postpone the
+	// refresh; zero waits for a quiet Interval however long it takes.
+	MaxDelay time.Duration
+	Refresh  func(ctx context.Context) error
+	// OnRefresh is called after every refresh with the number of triggers
+	// it served; it may be nil.
+	OnRefresh func(triggers int, err error)
+
+	mu       sync.Mutex
+	pending  int
+	merged   uint64
+	wake     chan struct{}
+	wakeOnce sync.Once
+}
+
+// NewDebouncer returns a Debouncer running refresh at most once per quiet
+// interval.
+func NewDebouncer(interval time.Duration, refresh func(ctx context.Context) error) *Debouncer {
+	return &Debouncer{Interval: interval, Refresh: refresh}
+}
+
+// SourceRefresh returns a Debouncer refresh function loading set from src.
+func SourceRefresh(set *IPSet, src Source) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		entries, err := src(ctx)
+		if err != nil {
+			return err
+		}
+		return set.RefreshContext(ctx, entries)
+	}
+}
+
+func (d *Debouncer) init() {
+	d.wakeOnce.Do(func() {
+		d.wake = make(chan struct{}, 1)
+	})
+}
+
+// Trigger requests a refresh. It never blocks.
+func (d *Debouncer) Trigger() {
+	d.init()
+	d.mu.Lock()
+	d.pending++
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Merged returns the number of triggers absorbed by refreshes serving
+// several triggers, i.e. the refreshes saved.
+func (d *Debouncer) Merged() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.merged
+}
+
+// Run serves the triggers until ctx is done.
+func (d *Debouncer) Run(ctx context.Context) error {
+	d.init()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.wake:
+		}
+		if err := d.settle(ctx); err != nil {
+			return err
+		}
+		d.mu.Lock()
+		n := d.pending
+		d.pending = 0
+		if n > 1 {
+			d.merged += uint64(n - 1)
+		}
+		d.mu.Unlock()
+		if n == 0 {
+			continue
+		}
+		err := d.Refresh(ctx)
+		if d.OnRefresh != nil {
+			d.OnRefresh(n, err)
+		}
+	}
+}
+
+// settle waits until no trigger arrived for Interval, or MaxDelay passed.
+func (d *Debouncer) settle(ctx context.Context) error {
+	var deadline <-chan time.Time
+	if d.MaxDelay > 0 {
+		t := time.NewTimer(d.MaxDelay)
+		defer t.Stop()
+		deadline = t.C
+	}
+	quiet := time.NewTimer(d.Interval)
+	defer quiet.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return nil
+		case <-quiet.C:
+			return nil
+		case <-d.wake:
+			quiet.Reset(d.Interval)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package go_ipset
+
+import (
+	"net/netip"
+	"sync"
+)
+
+// Transform computes the members of a derived set from the members of its
+// sources, given in the order the sources were declared.
+type Transform func(hashType string, sources [][]string) []string
+
+// UnionOf derives the combined members of all sources.
+func UnionOf() Transform {
+	return unionOf
+}
+
+// SubtractOf derives the members of the first source that are in none of
+// the others.
+func SubtractOf() Transform {
+	return func(hashType string, sources [][]string) []string {
+		if len(sources) == 0 {
+			return nil
+		}
+		res := sources[0]
+		for _, other := range sources[1:] {
+			res = subtractOf(hashType, res, other)
+		}
+		return res
+	}
+}
+
+// Aggregate derives the union of all sources with networks merged into the
+// fewest covering prefixes.
+func Aggregate() Transform {
+	return func(hashType string, sources [][]string) []string {
+		var ps []netip.Prefix
+		var rest []string
+		for _, m := range unionOf(hashType, sources) {
+			if p, ok := parsePrefix(m); ok {
+				ps = append(ps, p)
+			} else {
+				rest = append(rest, m)
+			}
+		}
+		for _, p := range AggregatePrefixes(ps) {
+			rest = append(rest, p.String())
+		}
+		return rest
+	}
+}
+
+// Filter derives the members of the union of all sources that keep accepts.
+func Filter(keep func(entry string) bool) Transform {
+	return func(hashType string, sources [][]string) []string {
+		var res []string
+		for _, m := range unionOf(hashType, sources) {
+			if keep(m) {
+				res = append(res, m)
+			}
+		}
+		return res
+	}
+}
+
+// Derived is a set whose content is computed from other sets and rebuilt,
+// then swapped in, whenever one of them is refreshed through its handle.
+type Derived struct {
+	Set       *IPSet
+	Sources   []*IPSet
+	Transform Transform
+	// OnError receives errors of automatic rebuilds; it may be nil.
+	OnError func(error)
+
+	mu sync.Mutex
+}
+
+// NewDerived declares set as derived from sources through t and hooks it to
+// their refreshes. It does not build the set; call Rebuild for that.
+func NewDerived(set *IPSet, t Transform, sources ...*IPSet) *Derived {
+	d := &Derived{Set: set, Sources: sources, Transform: t}
+	for _, src := range sources {
+		src.OnRefresh(func(*IPSet) {
+			if err := d.Rebuild(); err != nil && d.OnError != nil {
+				d.OnError(err)
+			}
+		})
+	}
+	return d
+}
+
+// Rebuild recomputes the derived set from the current content of its
+// sources and atomically replaces it.
+func (d *Derived) Rebuild() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lists, err := memberLists(d.Sources)
+	if err != nil {
+		return err
+	}
+	return d.Set.refresh(toEntries(d.Transform(d.Set.HashType, lists)))
+}
@@ -0,0 +1,113 @@
+package go_ipset
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// capNetAdmin is the capability needed to manage sets.
+const capNetAdmin = 12
+
+var protocolRe = regexp.MustCompile(`protocol version: (\d+)`)
+
+// Report is a snapshot of the state of ipset on the host, for support
+// bundles. It marshals to JSON.
+type Report struct {
+	Time     time.Time `json:"time"`
+	Version  string    `json:"version,omitempty"`
+	Protocol int       `json:"protocol,omitempty"`
+	// Modules are the loaded ip_set kernel modules, e.g. ip_set_hash_ip.
+	Modules []string `json:"modules"`
+	// NetAdmin reports whether the process has CAP_NET_ADMIN.
+	NetAdmin bool `json:"net_admin"`
+	// Sets are the headers of the sets on the host.
+	Sets         []SetInfo `json:"sets"`
+	TotalEntries int       `json:"total_entries"`
+	TotalMemory  int       `json:"total_memory"`
+	RecentErrors []OpError `json:"recent_errors"`
+	// Problems lists what could not be collected.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Diagnose collects a Report. Parts that cannot be collected are recorded
+// in Report.Problems instead of failing the report.
+func Diagnose() Report {
+	r := Report{Time: time.Now()}
+	if out, err := combinedOutput("version"); err != nil {
+		r.problem("ipset version: %v", err)
+	} else {
+		if m := versionRe.FindSubmatch(out); m != nil {
+			r.Version = string(m[1]) + "." + string(m[2])
+		}
+		if m := protocolRe.FindSubmatch(out); m != nil {
+			r.Protocol, _ = strconv.Atoi(string(m[1]))
+		}
+	}
+	var err error
+	if r.Modules, err = ipsetModules(); err != nil {
+		r.problem("kernel modules: %v", err)
+	}
+	if r.NetAdmin, err = hasCapability(capNetAdmin); err != nil {
+		r.problem("capabilities: %v", err)
+	}
+	if r.Sets, err = ListAllInfo(); err != nil {
+		r.problem("sets: %v", err)
+	}
+	for _, info := range r.Sets {
+		r.TotalEntries += info.NumEntries
+		r.TotalMemory += info.MemSize
+	}
+	r.RecentErrors = RecentErrors()
+	return r
+}
+
+func (r *Report) problem(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// ipsetModules returns the loaded ip_set modules listed in /proc/modules.
+func ipsetModules() ([]string, error) {
+	f, err := os.Open("/proc/modules")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mods []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		name, _, _ := strings.Cut(sc.Text(), " ")
+		if strings.HasPrefix(name, "ip_set") {
+			mods = append(mods, name)
+		}
+	}
+	return mods, sc.Err()
+}
+
+// hasCapability reports whether the effective capabilities of the process,
+// from /proc/self/status, include capability bit.
+func hasCapability(bit uint) (bool, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "CapEff:"); ok {
+			caps, err := strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+			if err != nil {
+				return false, err
+			}
+			return caps&(1<<bit) != 0, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return false, err
+	}
+	return false, fmt.Errorf("no CapEff in /proc/self/status")
+}
@@ -0,0 +1,208 @@
+package go_ipset
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Diff compares desired with the live content of the set and returns the
+// entries Sync would add and delete. Addresses and networks are compared
+// in canonical form, so 10.1.0.0/16 matches 10.1.2.3/16 in net types and
+// 192.0.2.1,80 matches 192.0.2.1,tcp:80 in port types.
+// With Owner, only entries of the owner are deleted.
+func (s *IPSet) Diff(desired []string) (toAdd, toDel []string, err error) {
+	if s.Owner == "" {
+		members, err := s.members()
+		if err != nil {
+			return nil, nil, err
+		}
+		toAdd, toDel = diffEntries(s.HashType, members, desired)
+		return toAdd, toDel, nil
+	}
+	return s.diffScoped(desired, s.Owned)
+}
+
+// DiffTag is Diff for the entries whose comment starts with tag, as
+// reconciled by SyncTag.
+func (s *IPSet) DiffTag(tag string, desired []string) (toAdd, toDel []string, err error) {
+	return s.diffScoped(desired, func(e Entry) bool {
+		return strings.HasPrefix(s.userComment(e.Comment), tag)
+	})
+}
+
+// diffScoped is Diff deleting only the entries in scope. Entries present
+// outside the scope are not added again, as a set holds an entry once.
+func (s *IPSet) diffScoped(desired []string, inScope func(Entry) bool) (toAdd, toDel []string, err error) {
+	entries, err := s.entries()
+	if err != nil {
+		return nil, nil, err
+	}
+	var members, scoped []string
+	for _, e := range entries {
+		members = append(members, e.Value)
+		if inScope(e) {
+			scoped = append(scoped, e.Value)
+		}
+	}
+	toAdd, _ = diffEntries(s.HashType, members, desired)
+	_, toDel = diffEntries(s.HashType, scoped, desired)
+	return toAdd, toDel, nil
+}
+
+// Sync brings the set to the desired content by adding and deleting only
+// the differing entries, instead of rebuilding it like Refresh. Every entry
+// is attempted; failures are reported in a *BatchError. Emptying a
+// protected set needs Force.
+func (s *IPSet) Sync(desired []string, opts ...ForceOption) error {
+	toAdd, toDel, err := s.Diff(desired)
+	if err != nil {
+		return err
+	}
+	if len(desired) == 0 && len(toDel) > 0 {
+		if err := s.guard("sync with no entries", opts); err != nil {
+			return err
+		}
+	}
+	return s.apply(toAdd, toDel, "")
+}
+
+// SyncTag is Sync limited to the entries whose comment starts with tag,
+// so that several controllers, or a controller and operators, can share
+// one set: entries outside the tag are neither deleted nor duplicated,
+// and added entries get tag as comment. Comments are matched without the
+// Owner tag and Defaults.CommentPrefix. The set needs Comment.
+func (s *IPSet) SyncTag(tag string, desired []string, opts ...ForceOption) error {
+	toAdd, toDel, err := s.DiffTag(tag, desired)
+	if err != nil {
+		return err
+	}
+	if len(desired) == 0 && len(toDel) > 0 {
+		if err := s.guard("sync with no entries", opts); err != nil {
+			return err
+		}
+	}
+	return s.apply(toAdd, toDel, tag)
+}
+
+// apply deletes toDel and adds toAdd with comment. Every entry is
+// attempted; failures are reported in a *BatchError. The generation is
+// bumped only when all of it succeeded and changed anything.
+func (s *IPSet) apply(toAdd, toDel []string, comment string) error {
+	var batch BatchError
+	for _, entry := range toDel {
+		batch.add(entry, s.Del(entry))
+	}
+	for _, entry := range toAdd {
+		batch.add(entry, s.AddEntry(Entry{Value: entry, Comment: comment}))
+	}
+	if err := batch.err(); err != nil {
+		return err
+	}
+	if activePlan(s.DryRun) == nil && len(toAdd)+len(toDel) > 0 {
+		s.mu.Lock()
+		s.bump()
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func diffEntries(hashType string, live, desired []string) (toAdd, toDel []string) {
+	have := make(map[string]bool, len(live))
+	for _, m := range live {
+		have[canonical(hashType, m)] = true
+	}
+	want := make(map[string]bool, len(desired))
+	for _, entry := range desired {
+		c := canonical(hashType, entry)
+		if !want[c] && !have[c] {
+			toAdd = append(toAdd, entry)
+		}
+		want[c] = true
+	}
+	for _, m := range live {
+		if !want[canonical(hashType, m)] {
+			toDel = append(toDel, m)
+		}
+	}
+	return toAdd, toDel
+}
+
+// canonical normalizes an entry the way the kernel lists it: addresses and
+// networks with host bits cleared and single hosts without a mask, ports
+// with their protocol, tcp unless given.
+func canonical(hashType, entry string) string {
+	if !strings.HasPrefix(hashType, "hash:ip") && !strings.HasPrefix(hashType, "hash:net") {
+		return entry
+	}
+	dims := typeDims(hashType)
+	parts := strings.Split(entry, ",")
+	for i := 0; i < len(parts) && i < len(dims); i++ {
+		switch dims[i] {
+		case "ip", "net":
+			if p, ok := parsePrefix(parts[i]); ok && p.IsSingleIP() {
+				parts[i] = p.Addr().String()
+			} else if ok {
+				parts[i] = p.String()
+			}
+		case "port":
+			parts[i] = canonicalPort(parts[i])
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// canonicalPort adds the default protocol tcp to a bare port number and
+// lowercases the protocol of a port.
+func canonicalPort(port string) string {
+	proto, num, ok := strings.Cut(port, ":")
+	if !ok {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return port
+		}
+		return "tcp:" + port
+	}
+	return strings.ToLower(proto) + ":" + num
+}
+
+// SymmetricDiff compares the live content of two sets and returns the
+// entries found only in a and only in b.
+func SymmetricDiff(a, b *IPSet) (onlyA, onlyB []string, err error) {
+	ma, err := a.members()
+	if err != nil {
+		return nil, nil, err
+	}
+	mb, err := b.members()
+	if err != nil {
+		return nil, nil, err
+	}
+	onlyB, onlyA = diffEntries(a.HashType, ma, mb)
+	return onlyA, onlyB, nil
+}
+
+// Equal reports whether two sets have the same members.
+func Equal(a, b *IPSet) (bool, error) {
+	onlyA, onlyB, err := SymmetricDiff(a, b)
+	if err != nil {
+		return false, err
+	}
+	return len(onlyA) == 0 && len(onlyB) == 0, nil
+}
+
+// DiffFile compares the set with an entry list file in the format read by
+// ReadEntries and returns the entries found only in the set and only in
+// the file.
+func (s *IPSet) DiffFile(path string) (onlySet, onlyFile []string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	entries, err := ReadEntries(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	onlyFile, onlySet, err = s.Diff(entries)
+	return onlySet, onlyFile, err
+}
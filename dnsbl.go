@@ -0,0 +1,124 @@
+package go_ipset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrDNSBLRefused is returned when a zone answers with one of the error codes
+// in 127.255.255.0/24, e.g. because it refuses queries relayed by public
+// resolvers.
+var ErrDNSBLRefused = errors.New("dnsbl refused query")
+
+var (
+	dnsblCodes  = netip.MustParsePrefix("127.0.0.0/8")
+	dnsblErrors = netip.MustParsePrefix("127.255.255.0/24")
+)
+
+// DNSBL checks addresses against DNS blocklists and adds listed ones to a
+// penalty set.
+type DNSBL struct {
+	Zones    []string
+	Set      *IPSet
+	Resolver *net.Resolver
+	// TTL is how long listed addresses stay in the set; defaults to 1h.
+	TTL time.Duration
+	// TTLFor, when set, derives the ban duration from a zone listing the
+	// address and its response codes (127.0.0.x). The longest non-zero
+	// result over all listing zones overrides TTL.
+	TTLFor func(zone string, codes []netip.Addr) time.Duration
+}
+
+// Lookup queries every zone for ip and returns the response codes of the
+// zones listing it. Only codes in 127.0.0.0/8 count as listings; error codes
+// in 127.255.255.0/24 fail the lookup with ErrDNSBLRefused.
+func (d *DNSBL) Lookup(ctx context.Context, ip string) (map[string][]netip.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	listed := make(map[string][]netip.Addr)
+	for _, zone := range d.Zones {
+		codes, err := resolver.LookupNetIP(ctx, "ip4", reverseName(addr)+"."+zone)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error querying %s for %s: %v", zone, ip, err)
+		}
+		var listing []netip.Addr
+		for _, code := range codes {
+			code = code.Unmap()
+			switch {
+			case dnsblErrors.Contains(code):
+				return nil, fmt.Errorf("%w: %s answered %s for %s", ErrDNSBLRefused, zone, code, ip)
+			case dnsblCodes.Contains(code):
+				listing = append(listing, code)
+			}
+		}
+		if len(listing) > 0 {
+			listed[zone] = listing
+		}
+	}
+	return listed, nil
+}
+
+// Check looks ip up and, if any zone lists it, adds it to the set. It
+// reports whether ip was listed.
+func (d *DNSBL) Check(ctx context.Context, ip string) (bool, error) {
+	listed, err := d.Lookup(ctx, ip)
+	if err != nil || len(listed) == 0 {
+		return false, err
+	}
+	var (
+		zones   []string
+		derived time.Duration
+	)
+	for zone, codes := range listed {
+		zones = append(zones, zone)
+		if d.TTLFor != nil {
+			derived = max(derived, d.TTLFor(zone, codes))
+		}
+	}
+	ttl := d.TTL
+	if derived > 0 {
+		ttl = derived
+	} else if ttl == 0 {
+		ttl = time.Hour
+	}
+	e := Entry{Value: ip, Timeout: ttl}
+	if d.Set.Comment {
+		sort.Strings(zones)
+		e.Comment = strings.Join(zones, ",")
+	}
+	return true, d.Set.AddEntry(e)
+}
+
+// reverseName returns the DNSBL query label of addr: reversed octets for
+// IPv4, reversed nibbles for IPv6.
+func reverseName(addr netip.Addr) string {
+	b := addr.Unmap().AsSlice()
+	var parts []string
+	if len(b) == 4 {
+		for i := 3; i >= 0; i-- {
+			parts = append(parts, fmt.Sprint(b[i]))
+		}
+		return strings.Join(parts, ".")
+	}
+	const hex = "0123456789abcdef"
+	for i := len(b) - 1; i >= 0; i-- {
+		parts = append(parts, string(hex[b[i]&0xf]), string(hex[b[i]>>4]))
+	}
+	return strings.Join(parts, ".")
+}
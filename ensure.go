@@ -0,0 +1,103 @@
+package go_ipset
+
+import "fmt"
+
+// EnsureIPSet makes sure the set described by sp exists, creating it if
+// needed. An existing set is never flushed; if its header differs from sp
+// an error is returned instead. Entries of sp are ensured present, other
+// members are left alone.
+func EnsureIPSet(sp *SetSpec) (*IPSet, error) {
+	if err := ValidName(sp.Name); err != nil {
+		return nil, err
+	}
+	s, err := New(sp.Name, sp.Type, &Params{
+		HashFamily: sp.Family,
+		HashSize:   sp.HashSize,
+		MaxElem:    sp.MaxElem,
+		Timeout:    sp.Timeout,
+		Comment:    sp.Comment,
+		Counters:   sp.Counters,
+		TimeoutExt: sp.TimeoutExt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.extra = sp.Extra
+	ok, err := s.Exists()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		info, err := s.Stats()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkHeader(info); err != nil {
+			return nil, err
+		}
+	} else if err := s.create(s.Name); err != nil {
+		return nil, err
+	}
+	for _, e := range sp.Entries {
+		if err := EnsureEntry(s, e.Value); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// checkHeader compares the header of an existing set with the handle. The
+// hash size is not compared since the kernel rounds it.
+func (s *IPSet) checkHeader(info *SetInfo) error {
+	mismatch := func(what string, want, got interface{}) error {
+		return fmt.Errorf("set %s exists with %s %v, want %v", s.Name, what, got, want)
+	}
+	switch {
+	case info.Type != s.HashType:
+		return mismatch("type", s.HashType, info.Type)
+	case info.Family != s.HashFamily:
+		return mismatch("family", s.HashFamily, info.Family)
+	case info.MaxElem != s.MaxElem:
+		return mismatch("maxelem", s.MaxElem, info.MaxElem)
+	case info.Timeout != s.Timeout:
+		return mismatch("timeout", s.Timeout, info.Timeout)
+	case info.Comment != s.Comment:
+		return mismatch("comment extension", s.Comment, info.Comment)
+	case info.Counters != s.Counters:
+		return mismatch("counters extension", s.Counters, info.Counters)
+	}
+	return nil
+}
+
+// EnsureEntry makes sure entry is in the set. It is checked against the set
+// type and family first, and adding an entry already present succeeds.
+func EnsureEntry(s *IPSet, entry string) error {
+	if err := s.validEntry(entry); err != nil {
+		return fmt.Errorf("error adding entry %s to set %s: %v", entry, s.Name, err)
+	}
+	opts, err := s.entryArgs(Entry{Value: entry})
+	if err != nil {
+		return fmt.Errorf("error adding entry %s to set %s: %w", entry, s.Name, err)
+	}
+	args := append([]string{"add", s.Name, entry}, opts...)
+	out, err := s.mutateShared(append(args, "-exist")...)
+	if full := s.fullError(s.Name, err); full != nil {
+		return full
+	}
+	if err != nil {
+		return fmt.Errorf("error adding entry %s: %w (%s)", entry, err, out)
+	}
+	s.track(Entry{Value: entry}, true)
+	return nil
+}
+
+// DeleteEntry makes sure entry is not in the set; deleting an absent entry
+// succeeds.
+func DeleteEntry(s *IPSet, entry string) error {
+	out, err := s.mutateShared("del", s.Name, entry, "-exist")
+	if err != nil {
+		return fmt.Errorf("error deleting entry %s: %w (%s)", entry, err, out)
+	}
+	s.track(Entry{Value: entry}, false)
+	return nil
+}
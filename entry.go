@@ -0,0 +1,194 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ExistPolicy decides what adding an entry that is already present, or
+// deleting one that is not, does.
+type ExistPolicy int
+
+const (
+	// ExistIgnore silently accepts both (ipset -exist).
+	ExistIgnore ExistPolicy = iota
+	// ExistFail makes them fail with ErrEntryExists and ErrEntryNotFound.
+	ExistFail
+)
+
+var (
+	// ErrEntryExists is returned by strict adds of an entry already present.
+	ErrEntryExists = errors.New("entry already in set")
+	// ErrEntryNotFound is returned by strict deletes of a missing entry.
+	ErrEntryNotFound = errors.New("entry not in set")
+	// ErrSetFull is matched by the *SetFullError of adds to a full set.
+	ErrSetFull = errors.New("set is full")
+)
+
+// SetFullError is returned by adds rejected because the set holds as many
+// entries as it can, with its occupancy read from the header afterwards,
+// so that callers can resize or evict instead of retrying.
+type SetFullError struct {
+	Set     string
+	Entries int
+	MaxElem int
+	Err     error
+}
+
+func (e *SetFullError) Error() string {
+	return fmt.Sprintf("set %s is full: %d of %d entries", e.Set, e.Entries, e.MaxElem)
+}
+
+func (e *SetFullError) Is(target error) bool {
+	return target == ErrSetFull
+}
+
+func (e *SetFullError) Unwrap() error {
+	return e.Err
+}
+
+// fullError returns a *SetFullError when err is an add to the set name
+// failing for lack of room, and nil otherwise.
+func (s *IPSet) fullError(name string, err error) error {
+	var ke *KernelError
+	if !errors.As(err, &ke) || ke.Reason != ReasonSetFull {
+		return nil
+	}
+	full := &SetFullError{Set: name, Entries: -1, MaxElem: s.MaxElem, Err: err}
+	if sets, lerr := listSets("-t", name); lerr == nil && len(sets) == 1 {
+		full.Entries = sets[0].NumEntries
+		full.MaxElem = sets[0].MaxElem
+	}
+	return full
+}
+
+// EntryDefaults holds the options applied to added entries that don't
+// specify their own.
+type EntryDefaults struct {
+	// Timeout applies to the entries of AddEntry and Refresh without a
+	// timeout of their own. Add and AddMany take their timeout as given.
+	Timeout       time.Duration
+	CommentPrefix string
+	Exist         ExistPolicy
+
+	// TimeoutJitter varies entry timeouts by up to this fraction in
+	// either direction, e.g. 0.1 for ±10%, so entries added together
+	// don't all expire in the same second. It applies to Add, AddMany,
+	// AddEntry and Refresh, to the timeout of the entry, Defaults.Timeout
+	// or the default timeout of the set, whichever comes first.
+	TimeoutJitter float64
+}
+
+// Entry is a set member together with its per-entry options.
+type Entry struct {
+	Value string
+	// Timeout is how long the entry stays in a set with the timeout
+	// extension, at most MaxTimeout, rounded up to whole seconds; zero
+	// falls back to Defaults.Timeout and then to the default timeout of
+	// the set, and leaves entries of sets without the extension untimed.
+	// Permanent adds it with timeout 0 instead, which never expires.
+	Timeout   time.Duration
+	Permanent bool
+	Comment   string
+	Packets   uint64
+	Bytes     uint64
+
+	// SkbMark, SkbPrio and SkbQueue are the skbinfo options of the entry;
+	// nil leaves them unset.
+	SkbMark  *SkbMark
+	SkbPrio  *SkbPrio
+	SkbQueue *uint16
+	NoMatch  bool
+
+	// Hostname is the reverse DNS name of the address, filled in by
+	// listings made with ListResolve.
+	Hostname string
+}
+
+// AddOption sets a per-entry option of Add.
+type AddOption func(e *Entry)
+
+// SeedCounters starts the packet and byte counters of the entry at the
+// given values, e.g. to carry them over from another set or host. The set
+// must have been created with counters.
+func SeedCounters(packets, bytes uint64) AddOption {
+	return func(e *Entry) {
+		e.Packets = packets
+		e.Bytes = bytes
+	}
+}
+
+// entryArgs renders the options of e, with s.Defaults filled in, as ipset
+// arguments.
+func (s *IPSet) entryArgs(e Entry) ([]string, error) {
+	if err := checkTimeout(e.Timeout); err != nil {
+		return nil, err
+	}
+	e.Timeout = s.entryTimeout(e)
+	if err := checkTimeout(e.Timeout); err != nil {
+		return nil, err
+	}
+	e.Comment = s.tagComment(s.Defaults.CommentPrefix + e.Comment)
+	return e.args(), nil
+}
+
+// entryTimeout returns the timeout e is added with: its own, else
+// s.Defaults.Timeout, else, when there is jitter to apply, the default
+// timeout of the set, which the kernel would not vary. Zero leaves the
+// timeout to the kernel.
+func (s *IPSet) entryTimeout(e Entry) time.Duration {
+	if e.Permanent {
+		return 0
+	}
+	d := e.Timeout
+	if d == 0 {
+		d = s.Defaults.Timeout
+	}
+	if d == 0 && s.Defaults.TimeoutJitter > 0 {
+		d = time.Duration(s.Timeout) * time.Second
+	}
+	return s.jitterTimeout(d)
+}
+
+// jitterTimeout applies s.Defaults.TimeoutJitter to a non-zero timeout,
+// keeping it at least one second.
+func (s *IPSet) jitterTimeout(d time.Duration) time.Duration {
+	if d <= 0 || s.Defaults.TimeoutJitter <= 0 {
+		return d
+	}
+	d = jitter(d, s.Defaults.TimeoutJitter).Round(time.Second)
+	return min(max(d, time.Second), MaxTimeout)
+}
+
+// args renders only the options set on e, leaving the rest to the kernel.
+func (e Entry) args() []string {
+	var args []string
+	if e.Timeout > 0 || e.Permanent {
+		args = append(args, "timeout", strconv.Itoa(timeoutSeconds(e.Timeout)))
+	}
+	if e.Comment != "" {
+		args = append(args, "comment", e.Comment)
+	}
+	if e.Packets > 0 {
+		args = append(args, "packets", strconv.FormatUint(e.Packets, 10))
+	}
+	if e.Bytes > 0 {
+		args = append(args, "bytes", strconv.FormatUint(e.Bytes, 10))
+	}
+	mark, prio, queue := e.skbStrings()
+	if mark != "" {
+		args = append(args, "skbmark", mark)
+	}
+	if prio != "" {
+		args = append(args, "skbprio", prio)
+	}
+	if queue != "" {
+		args = append(args, "skbqueue", queue)
+	}
+	if e.NoMatch {
+		args = append(args, "nomatch")
+	}
+	return args
+}
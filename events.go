@@ -0,0 +1,157 @@
+package go_ipset
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType says what an Event reports.
+type EventType int
+
+const (
+	// SetCreated reports a create, also of a set that already existed.
+	SetCreated EventType = iota + 1
+	// SetRefreshed reports a completed Refresh, or other replacement of
+	// the content of a set.
+	SetRefreshed
+	SetDestroyed
+	EntryAdded
+	EntryDeleted
+	// EntryExpired reports an entry an ExpiryWatcher found gone, whether
+	// it expired or was deleted outside the package.
+	EntryExpired
+	// SwapPerformed reports a swap of Set with Other, including the swaps
+	// by which Refresh replaces a set.
+	SwapPerformed
+	// Error reports a failed mutation, with Err set.
+	Error
+)
+
+var eventNames = [...]string{
+	SetCreated:    "set created",
+	SetRefreshed:  "set refreshed",
+	SetDestroyed:  "set destroyed",
+	EntryAdded:    "entry added",
+	EntryDeleted:  "entry deleted",
+	EntryExpired:  "entry expired",
+	SwapPerformed: "swap performed",
+	Error:         "error",
+}
+
+func (t EventType) String() string {
+	if t <= 0 || int(t) >= len(eventNames) {
+		return "unknown"
+	}
+	return eventNames[t]
+}
+
+// Event is a change of a set made by the package, or noticed by it.
+type Event struct {
+	Type  EventType
+	Time  time.Time
+	Set   string
+	Entry string
+	// Other is the second set of a swap.
+	Other string
+	Err   error
+}
+
+var (
+	eventsMu    sync.Mutex
+	subscribers = make(map[chan Event]bool)
+	// nsubscribers lets publishers skip building events nobody receives.
+	nsubscribers atomic.Int32
+	// droppedEvents counts the events not delivered to full channels.
+	droppedEvents atomic.Uint64
+)
+
+// Subscribe returns a channel receiving the events of all sets, with room
+// for buffer events, and a function ending the subscription and closing
+// the channel. Events that do not fit into the channel are dropped rather
+// than delaying the operation that caused them; DroppedEvents counts them.
+func Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	eventsMu.Lock()
+	subscribers[ch] = true
+	nsubscribers.Add(1)
+	eventsMu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			eventsMu.Lock()
+			delete(subscribers, ch)
+			nsubscribers.Add(-1)
+			eventsMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// DroppedEvents returns the number of events dropped for full subscriber
+// channels.
+func DroppedEvents() uint64 {
+	return droppedEvents.Load()
+}
+
+// publish delivers e to the subscribers.
+func publish(e Event) {
+	if nsubscribers.Load() == 0 {
+		return
+	}
+	e.Time = time.Now()
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- e:
+		default:
+			droppedEvents.Add(1)
+		}
+	}
+}
+
+// publishMutation publishes the event of the mutation args, which failed
+// with err unless it is nil.
+func publishMutation(args []string, err error) {
+	if nsubscribers.Load() == 0 {
+		return
+	}
+	i := 0
+	for i < len(args) && strings.HasPrefix(args[i], "-") {
+		i++
+	}
+	if i+1 >= len(args) {
+		return
+	}
+	cmd, rest := args[i], args[i+1:]
+	e := Event{Set: rest[0]}
+	if err != nil {
+		e.Type, e.Err = Error, err
+		publish(e)
+		return
+	}
+	switch cmd {
+	case "create":
+		e.Type = SetCreated
+	case "destroy":
+		e.Type = SetDestroyed
+	case "add", "del":
+		if len(rest) < 2 {
+			return
+		}
+		e.Type, e.Entry = EntryAdded, rest[1]
+		if cmd == "del" {
+			e.Type = EntryDeleted
+		}
+	case "swap":
+		if len(rest) < 2 {
+			return
+		}
+		e.Type, e.Other = SwapPerformed, rest[1]
+	default:
+		return
+	}
+	publish(e)
+}
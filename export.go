@@ -0,0 +1,44 @@
+package go_ipset
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{"entry", "timeout", "comment", "packets", "bytes"}
+
+// ExportCSV writes the members of the set with their extensions to w as
+// CSV. Use '\t' as comma for TSV.
+func (s *IPSet) ExportCSV(w io.Writer, comma rune) error {
+	info, err := s.List()
+	if err != nil {
+		return err
+	}
+	return WriteCSV(w, info.Members, comma)
+}
+
+// WriteCSV writes entries to w as CSV with a header row. Timeouts are in
+// seconds.
+func WriteCSV(w io.Writer, entries []Entry, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		err := cw.Write([]string{
+			e.Value,
+			strconv.Itoa(int(e.Timeout / time.Second)),
+			e.Comment,
+			strconv.FormatUint(e.Packets, 10),
+			strconv.FormatUint(e.Bytes, 10),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
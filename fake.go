@@ -0,0 +1,338 @@
+package go_ipset
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fakeBackend keeps sets in memory instead of the kernel.
+type fakeBackend struct {
+	mu   sync.Mutex
+	sets []*fakeSet
+}
+
+type fakeSet struct {
+	info    SetInfo
+	members []Entry
+}
+
+// FakeBackend returns a backend keeping sets in memory, for tests and for
+// platforms without ipset. It carries out the commands this package issues
+// on the hash set types, failing like the ipset utility does, but entries
+// never expire and no packet is ever matched.
+func FakeBackend() Backend {
+	return &fakeBackend{}
+}
+
+func (b *fakeBackend) Run(stdin io.Reader, args ...string) ([]byte, []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return runCommand(stdin, args, b.command)
+}
+
+func fakeUnsupported(format string, a ...any) error {
+	what := fmt.Sprintf(format, a...)
+	return &nlError{what + " is not supported by the fake backend", fmt.Errorf("%w: %s", ErrUnsupported, what)}
+}
+
+func (b *fakeBackend) command(c nlCommand, args []string) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, syntaxErr("No command specified")
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "create", "-N", "n":
+		return nil, b.create(c, args)
+	case "add", "-A", "a":
+		return nil, b.add(c, args)
+	case "del", "-D", "d":
+		return nil, b.del(c, args)
+	case "test", "-T", "t":
+		return b.test(args)
+	case "destroy", "-X", "x":
+		return nil, b.destroy(args)
+	case "flush", "-F", "f":
+		return nil, b.flush(args)
+	case "rename", "-E", "e":
+		return nil, b.rename(args)
+	case "swap", "-W", "w":
+		return nil, b.swap(args)
+	case "list", "-L", "l":
+		return b.list(c, args)
+	case "save", "-S", "s":
+		c.output = "save"
+		return b.list(c, args)
+	}
+	return nil, fakeUnsupported("command %s", cmd)
+}
+
+// find returns the index of the named set, or -1.
+func (b *fakeBackend) find(name string) int {
+	for i, fs := range b.sets {
+		if fs.info.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookup returns the named set, failing with the error of cmd when it does
+// not exist.
+func (b *fakeBackend) lookup(cmd uint8, name string) (*fakeSet, error) {
+	i := b.find(name)
+	if i < 0 {
+		return nil, kernelErr(cmd, nlErrno(syscall.ENOENT))
+	}
+	return b.sets[i], nil
+}
+
+func (b *fakeBackend) create(c nlCommand, args []string) error {
+	if len(args) < 2 {
+		return syntaxErr("create requires a set name and type")
+	}
+	if !knownTypes[args[1]] {
+		return kernelErr(ipsetCmdCreate, ipsetErrFindType)
+	}
+	info := SetInfo{Name: args[0], Type: args[1], Family: DefaultFamily, HashSize: DefaultHashSize, MaxElem: DefaultMaxElem}
+	for i := 2; i < len(args); i++ {
+		opt := args[i]
+		switch opt {
+		case "counters":
+			info.Counters = true
+		case "comment":
+			info.Comment = true
+		case "forceadd":
+			info.ForceAdd = true
+		case "skbinfo":
+			info.SkbInfo = true
+		case "family", "hashsize", "maxelem", "timeout", "netmask", "bucketsize":
+			if i+1 >= len(args) {
+				return syntaxErr("Missing value of create option %s", opt)
+			}
+			i++
+			if opt == "family" {
+				if !knownFamilies[args[i]] {
+					return syntaxErr("Unknown family %s", args[i])
+				}
+				info.Family = args[i]
+				continue
+			}
+			n, err := strconv.ParseUint(args[i], 10, 32)
+			if err != nil {
+				return syntaxErr("Invalid value %s of create option %s", args[i], opt)
+			}
+			switch opt {
+			case "hashsize":
+				info.HashSize = int(n)
+			case "maxelem":
+				info.MaxElem = int(n)
+			case "timeout":
+				info.Timeout = int(n)
+				info.timeoutExt = true
+			}
+		default:
+			return fakeUnsupported("create option %s", opt)
+		}
+	}
+	if i := b.find(info.Name); i >= 0 {
+		old := b.sets[i].info
+		if c.exist && old.Type == info.Type && old.Family == info.Family {
+			return nil
+		}
+		return kernelErr(ipsetCmdCreate, ipsetErrExist)
+	}
+	b.sets = append(b.sets, &fakeSet{info: info})
+	return nil
+}
+
+// entry parses the set name, member value and options of an add, del or
+// test command.
+func (b *fakeBackend) entry(cmd uint8, args []string) (*fakeSet, Entry, error) {
+	if len(args) < 2 {
+		return nil, Entry{}, syntaxErr("A set name and an entry are required")
+	}
+	fs, err := b.lookup(cmd, args[0])
+	if err != nil {
+		return nil, Entry{}, err
+	}
+	value := canonical(fs.info.Type, args[1])
+	if p, ok := parsePrefix(value); ok {
+		if fs.info.Family == FamilyInet && !p.Addr().Is4() {
+			return nil, Entry{}, kernelErr(cmd, ipsetErrIPv4)
+		}
+		if fs.info.Family == FamilyInet6 && p.Addr().Is4() {
+			return nil, Entry{}, kernelErr(cmd, ipsetErrIPv6)
+		}
+	}
+	e := parseEntry(value, args[2:])
+	switch {
+	case (e.Timeout > 0 || e.Permanent) && !fs.info.timeoutExt:
+		return nil, Entry{}, kernelErr(cmd, ipsetErrTimeout)
+	case (e.Packets > 0 || e.Bytes > 0) && !fs.info.Counters:
+		return nil, Entry{}, kernelErr(cmd, ipsetErrCounter)
+	case e.Comment != "" && !fs.info.Comment:
+		return nil, Entry{}, kernelErr(cmd, ipsetErrComment)
+	}
+	if e.Timeout == 0 && !e.Permanent {
+		e.Timeout = time.Duration(fs.info.Timeout) * time.Second
+	}
+	return fs, e, nil
+}
+
+// index returns the index of the member with value, or -1.
+func (fs *fakeSet) index(value string) int {
+	for i, m := range fs.members {
+		if m.Value == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *fakeBackend) add(c nlCommand, args []string) error {
+	fs, e, err := b.entry(ipsetCmdAdd, args)
+	if err != nil {
+		return err
+	}
+	if i := fs.index(e.Value); i >= 0 {
+		if !c.exist {
+			return kernelErr(ipsetCmdAdd, ipsetErrExist)
+		}
+		fs.members[i] = e
+		return nil
+	}
+	if len(fs.members) >= fs.info.MaxElem {
+		if !fs.info.ForceAdd {
+			return kernelErr(ipsetCmdAdd, ipsetErrHashFull)
+		}
+		fs.members = fs.members[1:]
+	}
+	fs.members = append(fs.members, e)
+	return nil
+}
+
+func (b *fakeBackend) del(c nlCommand, args []string) error {
+	fs, e, err := b.entry(ipsetCmdDel, args)
+	if err != nil {
+		return err
+	}
+	i := fs.index(e.Value)
+	if i < 0 {
+		if !c.exist {
+			return kernelErr(ipsetCmdDel, ipsetErrExist)
+		}
+		return nil
+	}
+	fs.members = append(fs.members[:i], fs.members[i+1:]...)
+	return nil
+}
+
+func (b *fakeBackend) test(args []string) ([]byte, error) {
+	fs, e, err := b.entry(ipsetCmdTest, args)
+	if err != nil {
+		return nil, err
+	}
+	if fs.index(e.Value) < 0 {
+		return nil, &nlError{fmt.Sprintf("%s is NOT in set %s.", args[1], args[0]), ipsetErrExist}
+	}
+	return []byte(fmt.Sprintf("%s is in set %s.\n", args[1], args[0])), nil
+}
+
+func (b *fakeBackend) destroy(args []string) error {
+	if len(args) > 1 {
+		return syntaxErr("Wrong number of set names")
+	}
+	if len(args) == 0 {
+		b.sets = nil
+		return nil
+	}
+	i := b.find(args[0])
+	if i < 0 {
+		return kernelErr(ipsetCmdDestroy, nlErrno(syscall.ENOENT))
+	}
+	b.sets = append(b.sets[:i], b.sets[i+1:]...)
+	return nil
+}
+
+func (b *fakeBackend) flush(args []string) error {
+	if len(args) > 1 {
+		return syntaxErr("Wrong number of set names")
+	}
+	if len(args) == 0 {
+		for _, fs := range b.sets {
+			fs.members = nil
+		}
+		return nil
+	}
+	fs, err := b.lookup(ipsetCmdFlush, args[0])
+	if err != nil {
+		return err
+	}
+	fs.members = nil
+	return nil
+}
+
+func (b *fakeBackend) rename(args []string) error {
+	if len(args) != 2 {
+		return syntaxErr("Wrong number of set names")
+	}
+	fs, err := b.lookup(ipsetCmdRename, args[0])
+	if err != nil {
+		return err
+	}
+	if b.find(args[1]) >= 0 {
+		return kernelErr(ipsetCmdRename, ipsetErrExistSetname2)
+	}
+	fs.info.Name = args[1]
+	return nil
+}
+
+func (b *fakeBackend) swap(args []string) error {
+	if len(args) != 2 {
+		return syntaxErr("Wrong number of set names")
+	}
+	i, j := b.find(args[0]), b.find(args[1])
+	if i < 0 {
+		return kernelErr(ipsetCmdSwap, nlErrno(syscall.ENOENT))
+	}
+	if j < 0 {
+		return kernelErr(ipsetCmdSwap, ipsetErrExistSetname2)
+	}
+	from, to := b.sets[i], b.sets[j]
+	if from.info.Type != to.info.Type || from.info.Family != to.info.Family {
+		return kernelErr(ipsetCmdSwap, ipsetErrTypeMismatch)
+	}
+	from.info.Name, to.info.Name = to.info.Name, from.info.Name
+	b.sets[i], b.sets[j] = to, from
+	return nil
+}
+
+func (b *fakeBackend) list(c nlCommand, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, syntaxErr("Wrong number of set names")
+	}
+	if !c.names && c.output != "xml" && c.output != "save" {
+		return nil, fakeUnsupported("list output %q", c.output)
+	}
+	sets := b.sets
+	if len(args) == 1 {
+		fs, err := b.lookup(ipsetCmdList, args[0])
+		if err != nil {
+			return nil, err
+		}
+		sets = []*fakeSet{fs}
+	}
+	infos := make([]SetInfo, len(sets))
+	for i, fs := range sets {
+		infos[i] = fs.info
+		infos[i].NumEntries = len(fs.members)
+		if !c.terse {
+			infos[i].Members = append([]Entry(nil), fs.members...)
+		}
+	}
+	return renderList(c, infos)
+}
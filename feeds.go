@@ -0,0 +1,155 @@
+package go_ipset
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Public lists the feed parsers below understand.
+const (
+	TorExitListURL   = "https://check.torproject.org/torbulkexitlist"
+	SpamhausDROPURL  = "https://www.spamhaus.org/drop/drop.txt"
+	SpamhausEDROPURL = "https://www.spamhaus.org/drop/edrop.txt"
+)
+
+// ErrUnrecognizedFeed is returned by the feed parsers for input with content
+// but no entries, e.g. an HTML error page or a changed format served with
+// status 200, which would otherwise empty the set fed from it.
+var ErrUnrecognizedFeed = errors.New("feed has content but no entries")
+
+// FeedParser turns a downloaded list into set entries.
+type FeedParser func(r io.Reader) ([]string, error)
+
+// FeedSource returns a Scheduler Source downloading url and parsing it.
+func FeedSource(client *http.Client, url string, parse FeedParser) Source {
+	return func(ctx context.Context) ([]string, error) {
+		data, err := httpGet(ctx, client, url)
+		if err != nil {
+			return nil, err
+		}
+		return parse(bytes.NewReader(data))
+	}
+}
+
+// ParseTorExitList reads the Tor bulk exit list (one address per line) as
+// well as the older exit-addresses format with ExitAddress lines.
+func ParseTorExitList(r io.Reader) ([]string, error) {
+	var n feedNormalizer
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		switch {
+		case len(fields) >= 2 && fields[0] == "ExitAddress":
+			n.add(fields[1])
+		case len(fields) == 1:
+			n.add(fields[0])
+		case len(fields) > 1:
+			n.skipped++
+		}
+	}
+	return n.result(sc.Err())
+}
+
+// ParseSpamhausDROP reads the Spamhaus DROP and EDROP lists, either in the
+// text format ("1.2.3.0/24 ; SBL123", ; comments) or in the JSON lines
+// format with one {"cidr": ...} object per line.
+func ParseSpamhausDROP(r io.Reader) ([]string, error) {
+	var n feedNormalizer
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "{") {
+			var rec struct {
+				CIDR string `json:"cidr"`
+			}
+			if json.Unmarshal([]byte(line), &rec) == nil {
+				n.add(rec.CIDR)
+			} else {
+				n.skipped++
+			}
+			continue
+		}
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		n.add(strings.TrimSpace(line))
+	}
+	return n.result(sc.Err())
+}
+
+// ParseAbuseIPDB reads an AbuseIPDB blacklist export, either the JSON API
+// response or its plaintext variant with one address per line.
+func ParseAbuseIPDB(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var n feedNormalizer
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var doc struct {
+			Data []struct {
+				IPAddress string `json:"ipAddress"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, err
+		}
+		if doc.Data == nil {
+			// e.g. an error response
+			return nil, ErrUnrecognizedFeed
+		}
+		for _, d := range doc.Data {
+			n.add(d.IPAddress)
+		}
+		return n.entries, nil
+	}
+	for _, line := range strings.Fields(string(data)) {
+		n.add(line)
+	}
+	return n.result(nil)
+}
+
+// feedNormalizer collects valid addresses and networks in canonical form,
+// dropping duplicates and anything else.
+type feedNormalizer struct {
+	entries []string
+	seen    map[string]bool
+	// skipped counts the non-empty items that were not entries.
+	skipped int
+}
+
+func (n *feedNormalizer) add(v string) {
+	p, ok := parsePrefix(v)
+	if !ok {
+		if v != "" {
+			n.skipped++
+		}
+		return
+	}
+	if n.seen == nil {
+		n.seen = make(map[string]bool)
+	}
+	c := p.String()
+	if p.IsSingleIP() {
+		c = p.Addr().String()
+	}
+	if !n.seen[c] {
+		n.seen[c] = true
+		n.entries = append(n.entries, c)
+	}
+}
+
+// result returns the entries, or ErrUnrecognizedFeed when the input had
+// content but no entries.
+func (n *feedNormalizer) result(err error) ([]string, error) {
+	if err == nil && len(n.entries) == 0 && n.skipped > 0 {
+		return nil, ErrUnrecognizedFeed
+	}
+	return n.entries, err
+}
@@ -0,0 +1,154 @@
+package go_ipset
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ChecksumHeader is the response header a Follower checks the snapshot
+// body against, holding its hex SHA-256.
+const ChecksumHeader = "X-Checksum-Sha256"
+
+// Follower periodically fetches a save-format snapshot over HTTP and
+// atomically applies every set in it. Unchanged snapshots are skipped using
+// ETag revalidation.
+type Follower struct {
+	URL      string
+	Client   *http.Client
+	Interval time.Duration
+	Jitter   float64
+	// ChecksumURL optionally names a file holding the hex SHA-256 of the
+	// snapshot; the ChecksumHeader of the response is used otherwise, if
+	// present.
+	ChecksumURL string
+	// Replica, when set, requires snapshots signed by a Publisher.
+	Replica *Replica
+	// OnPoll is called after every poll; it may be nil.
+	OnPoll func(applied bool, err error)
+
+	etag string
+}
+
+// Run polls every Interval until ctx is done.
+func (f *Follower) Run(ctx context.Context) error {
+	for {
+		applied, err := f.Poll(ctx)
+		if f.OnPoll != nil {
+			f.OnPoll(applied, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(jitter(f.Interval, f.Jitter)):
+		}
+	}
+}
+
+// Poll fetches the snapshot once and applies it if it changed.
+func (f *Follower) Poll(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("error fetching snapshot %s: %s", f.URL, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	want := resp.Header.Get(ChecksumHeader)
+	if f.ChecksumURL != "" {
+		if want, err = f.fetchChecksum(ctx); err != nil {
+			return false, err
+		}
+	}
+	if want != "" {
+		sum := sha256.Sum256(body)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), want) {
+			return false, fmt.Errorf("snapshot %s checksum mismatch", f.URL)
+		}
+	}
+	if f.Replica != nil {
+		err = f.Replica.Apply(bytes.NewReader(body))
+	} else {
+		err = applySnapshot(body)
+	}
+	if err != nil {
+		return false, err
+	}
+	f.etag = resp.Header.Get("ETag")
+	return true, nil
+}
+
+func (f *Follower) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+	return http.DefaultClient
+}
+
+// fetchChecksum returns the first word of the checksum file, as written by
+// sha256sum.
+func (f *Follower) fetchChecksum(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.ChecksumURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching checksum %s: %s", f.ChecksumURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum %s", f.ChecksumURL)
+	}
+	return fields[0], nil
+}
+
+// applySnapshot atomically replaces the content of every set in a
+// save-format snapshot. Every set is checked before any is replaced, so
+// that an unsupported one does not leave the snapshot half applied.
+func applySnapshot(data []byte) error {
+	specs, err := ParseRestore(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for i := range specs {
+		if _, err := specs[i].handle(); err != nil {
+			return fmt.Errorf("set %s: %w", specs[i].Name, err)
+		}
+	}
+	for i := range specs {
+		if _, err := ApplySpec(&specs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,27 +1,58 @@
 package go_ipset
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"os/exec"
+	"net/netip"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-var (
-	ipsetPath string
-	errIpsetNotFound = errors.New("Ipset utility not found")
-)
+var errIpsetNotFound = errors.New("Ipset utility not found")
+
+// ErrSetExists is returned by strict creates when the set name is taken.
+var ErrSetExists = errors.New("set already exists")
 
 type Params struct {
 	HashFamily string
 	HashSize   int
 	MaxElem    int
 	Timeout    int
+	Comment    bool
+	Counters   bool
 	Create     bool
+
+	// TimeoutExt creates the set with the timeout extension even though
+	// Timeout is 0, so that entries may carry their own timeouts. It is
+	// implied by a non-zero Timeout.
+	TimeoutExt bool
+
+	// CreateStrict, with Create, fails New with ErrSetExists instead of
+	// reusing a set of the same name.
+	CreateStrict bool
+
+	// AllowUnknownType skips the check of the hash type against the
+	// types this package knows about.
+	AllowUnknownType bool
+
+	// Protected, see IPSet.Protected. With Create, an existing set is
+	// kept as it is instead of being flushed.
+	Protected bool
+
+	// defaultMaxElem is set when MaxElem was left to DefaultMaxElem.
+	defaultMaxElem bool
 }
 
+// IPSet is a handle for a set. Its methods are safe for concurrent use;
+// the exported fields must not be changed once the handle is shared.
+// Commands conflicting on the same set, such as an Add and a Refresh
+// swapping in a new set, are serialized within the process, also between
+// distinct handles of the set.
 type IPSet struct {
 	Name       string
 	HashType   string
@@ -29,57 +60,175 @@ type IPSet struct {
 	HashSize   int
 	MaxElem    int
 	Timeout    int
-}
+	Comment    bool
+	Counters   bool
+	// TimeoutExt, see Params.TimeoutExt.
+	TimeoutExt bool
 
-func initCheck() error {
-	if ipsetPath == "" {
-		path, err := exec.LookPath("ipset")
-		if err != nil {
-			return errIpsetNotFound
-		}
-		ipsetPath = path
-	}
-	return nil
+	// Defaults are applied by Add and AddEntry to options the caller
+	// leaves unset.
+	Defaults EntryDefaults
+
+	// Conntrack selects the mutations after which connection tracking
+	// entries of the affected address are flushed. The mutation succeeds
+	// even if the flush fails; the failure is passed to OnWarning.
+	Conntrack ConntrackFlush
+
+	// DryRun, when set, records mutations of this set into the plan
+	// instead of executing them. See also SetDryRun.
+	DryRun *Plan
+
+	// Locker, when set, is held by Refresh while replacing the set, to
+	// keep other processes from interleaving. See also SetLocker.
+	Locker Locker
+
+	// Pacing splits the loads of Refresh and RefreshFromReader into
+	// batches.
+	Pacing LoadPacing
+
+	// Staging names the temporary sets of Refresh; nil appends "-temp".
+	Staging Staging
+
+	// Protected makes Flush, Destroy and any operation emptying the set,
+	// such as a Refresh, Sync or Union with no entries, fail with
+	// ErrProtected unless given Force, to guard e.g. a primary allowlist
+	// against cleanup mistakes. Set operations and Derived, which take no
+	// options, cannot empty a protected set.
+	Protected bool
+
+	// ReadOnly makes the changes through the handle fail with ErrReadOnly
+	// while reads keep working. See also SetReadOnly.
+	ReadOnly bool
+
+	// Owner, when set, tags the entries added through the handle with the
+	// comment "owner=<Owner>", which needs a set created with Comment.
+	// Refresh and Sync then leave untagged entries alone, so entries an
+	// operator adds by hand survive them.
+	Owner string
+
+	// mu guards the handle state below.
+	mu sync.Mutex
+	// extra holds create options without a field of their own, e.g. from
+	// a SetSpec.
+	extra []string
+	// defaultMaxElem is set when MaxElem was not given to New.
+	defaultMaxElem bool
+	// desired is the last known intended content of the set, as of the
+	// last replace; added and deleted track the single-entry mutations
+	// since, keyed by canonical value.
+	desired    []Entry
+	added      map[string]trackedEntry
+	deleted    map[string]bool
+	trackLimit int
+	// generation counts the successful Refresh and changing Sync calls,
+	// the last at changedAt.
+	generation uint64
+	changedAt  time.Time
+
+	onRefresh []func(s *IPSet)
+	onChange  []func(added, deleted []string)
+	onWarning []func(warning string)
 }
 
 func (s *IPSet) createHashSet(name string) error {
-	out, err := exec.Command(ipsetPath, "create", name, s.HashType, "family",
-		s.HashFamily, "hashsize", strconv.Itoa(s.HashSize), "maxelem",
-		strconv.Itoa(s.MaxElem), "timeout", strconv.Itoa(s.Timeout), "-exist").CombinedOutput()
+	err := s.create(name)
 	if err != nil {
-		return fmt.Errorf("error creating ipset %s with type %s: %v (%s)", name, s.HashType, err, out)
+		return err
 	}
-	out, err = exec.Command(ipsetPath, "flush", name).CombinedOutput()
+	out, err := s.mutate("flush", name)
 	if err != nil {
-		return fmt.Errorf("error flushing ipset %s: %v (%s)", name, err, out)
+		return fmt.Errorf("error flushing ipset %s: %w (%s)", name, err, out)
 	}
 	return nil
 }
 
+// create creates the set name with the header of s, keeping its members if
+// it already exists.
+func (s *IPSet) create(name string) error {
+	out, err := s.mutate(append(s.createArgs(name), "-exist")...)
+	if err != nil {
+		return fmt.Errorf("error creating ipset %s with type %s: %w (%s)", name, s.HashType, err, out)
+	}
+	return nil
+}
 
-func New(name string, hashtype string, p *Params) (*IPSet, error) {
-	if p.HashSize == 0 {
-		p.HashSize = 1024
+// CreateStrict creates the set, failing with ErrSetExists when a set of
+// the same name exists already, e.g. one owned by other software.
+func (s *IPSet) CreateStrict() error {
+	out, err := s.mutate(s.createArgs(s.Name)...)
+	if err != nil {
+		if strings.Contains(string(out), "set with the same name already exists") {
+			return fmt.Errorf("%w: %s", ErrSetExists, s.Name)
+		}
+		return fmt.Errorf("error creating ipset %s with type %s: %w (%s)", s.Name, s.HashType, err, out)
 	}
+	return nil
+}
 
-	if p.MaxElem == 0 {
-		p.MaxElem = 65536
+// createArgs returns the ipset arguments creating the set name with the
+// header of s.
+func (s *IPSet) createArgs(name string) []string {
+	args := []string{"create", name, s.HashType, "family",
+		s.HashFamily, "hashsize", strconv.Itoa(s.HashSize), "maxelem",
+		strconv.Itoa(s.MaxElem)}
+	if s.Timeout > 0 || s.TimeoutExt {
+		args = append(args, "timeout", strconv.Itoa(s.Timeout))
+	}
+	if s.Counters {
+		args = append(args, "counters")
+	}
+	if s.Comment {
+		args = append(args, "comment")
 	}
+	return append(args, s.extra...)
+}
 
-	if p.HashFamily == "" {
-		p.HashFamily = "inet"
+// New returns a handle for the named hash set, configured by opts. Passing a
+// *Params works as before; the With* options can be mixed in after it. Nil
+// options, including a nil *Params, are ignored, so New(name, type, nil)
+// uses the defaults.
+func New(name string, hashtype string, opts ...Option) (*IPSet, error) {
+	p, err := resolveParams(opts)
+	if err != nil {
+		return nil, err
 	}
 
 	if !strings.HasPrefix(hashtype, "hash:") {
 		return nil, fmt.Errorf("not a hash type: %s", hashtype)
 	}
 
+	if !knownTypes[hashtype] && !p.AllowUnknownType {
+		return nil, fmt.Errorf("unknown hash type: %s", hashtype)
+	}
+
 	if err := initCheck(); err != nil {
 		return nil, err
 	}
 
-	s := IPSet{name, hashtype, p.HashFamily, p.HashSize, p.MaxElem, p.Timeout}
-	if p.Create == true {
+	s := IPSet{
+		Name:       name,
+		HashType:   hashtype,
+		HashFamily: p.HashFamily,
+		HashSize:   p.HashSize,
+		MaxElem:    p.MaxElem,
+		Timeout:    p.Timeout,
+		Comment:    p.Comment,
+		Counters:   p.Counters,
+		TimeoutExt: p.TimeoutExt,
+		Protected:  p.Protected,
+
+		defaultMaxElem: p.defaultMaxElem,
+	}
+	if p.Create == true && p.CreateStrict {
+		if err := s.CreateStrict(); err != nil {
+			return nil, err
+		}
+	} else if p.Create == true && p.Protected {
+		// the content of an existing protected set is kept
+		if err := s.create(name); err != nil {
+			return nil, err
+		}
+	} else if p.Create == true {
 		err := s.createHashSet(name)
 		if err != nil {
 			return nil, err
@@ -88,32 +237,366 @@ func New(name string, hashtype string, p *Params) (*IPSet, error) {
 	return &s, nil
 }
 
-func (s *IPSet) Refresh(entries []string) error {
-	tempName := s.Name + "-temp"
-	err := s.createHashSet(tempName)
+// Refresh atomically replaces the content of the set with entries.
+// Emptying a protected set needs Force.
+func (s *IPSet) Refresh(entries []string, opts ...ForceOption) error {
+	return s.RefreshContext(context.Background(), entries, opts...)
+}
+
+// RefreshContext is Refresh giving up once ctx is done: the load stops, the
+// temporary set is destroyed, the set keeps its content and the error wraps
+// ctx.Err() with the number of entries loaded so far.
+func (s *IPSet) RefreshContext(ctx context.Context, entries []string, opts ...ForceOption) error {
+	list := make([]Entry, len(entries))
+	for i, entry := range entries {
+		list[i] = Entry{Value: entry}
+	}
+	return s.refreshEntries(ctx, list, opts)
+}
+
+// RefreshEntries is like Refresh, but each entry carries its own options,
+// such as a timeout, comment or nomatch flag; unset ones fall back to the
+// set defaults.
+func (s *IPSet) RefreshEntries(entries []Entry, opts ...ForceOption) error {
+	return s.refreshEntries(context.Background(), append([]Entry(nil), entries...), opts)
+}
+
+func (s *IPSet) refreshEntries(ctx context.Context, entries []Entry, opts []ForceOption) error {
+	return s.refreshContext(ctx, entries, opts...)
+}
+
+// Keep selects the per-entry state RefreshKeep carries over for entries
+// that stay in the set.
+type Keep int
+
+const (
+	KeepTimeouts Keep = 1 << iota
+	KeepCounters
+)
+
+// RefreshKeepTimeouts is like Refresh, but entries already in the set keep
+// their remaining timeout instead of starting over with the set default.
+func (s *IPSet) RefreshKeepTimeouts(entries []string, opts ...ForceOption) error {
+	return s.RefreshKeep(entries, KeepTimeouts, opts...)
+}
+
+// RefreshKeep is like Refresh, but entries already in the set keep the state
+// selected by keep. KeepCounters requires a set with the counters extension.
+func (s *IPSet) RefreshKeep(entries []string, keep Keep, opts ...ForceOption) error {
+	if keep&KeepCounters != 0 && !s.Counters {
+		return fmt.Errorf("set %s has no counters extension", s.Name)
+	}
+	current, err := s.entries()
 	if err != nil {
 		return err
 	}
-	for _, entry := range entries {
-		out, err := exec.Command(ipsetPath, "add", tempName, entry, "-exist").CombinedOutput()
-		if err != nil {
-			fmt.Errorf("error adding entry %s to set %s: %v (%s)", entry, tempName, err, out)
+	existing := make(map[string]Entry, len(current))
+	for _, e := range current {
+		existing[e.Value] = e
+	}
+	list := make([]Entry, len(entries))
+	for i, entry := range entries {
+		list[i] = Entry{Value: entry}
+		old, ok := existing[entry]
+		if !ok {
+			continue
+		}
+		if keep&KeepTimeouts != 0 {
+			list[i].Timeout, list[i].Permanent = old.Timeout, old.Permanent
+		}
+		if keep&KeepCounters != 0 {
+			list[i].Packets = old.Packets
+			list[i].Bytes = old.Bytes
 		}
 	}
-	err = Swap(tempName, s.Name)
-	if err != nil {
+	return s.refresh(list, opts...)
+}
+
+// refresh loads entries into a temporary set and swaps it with s. Emptying
+// a protected set needs Force.
+func (s *IPSet) refresh(entries []Entry, opts ...ForceOption) error {
+	return s.refreshContext(context.Background(), entries, opts...)
+}
+
+func (s *IPSet) refreshContext(ctx context.Context, entries []Entry, opts ...ForceOption) error {
+	for _, e := range entries {
+		if err := checkTimeout(e.Timeout); err != nil {
+			return fmt.Errorf("entry %s: %w", e.Value, err)
+		}
+	}
+	return s.replace(func(tempName string) ([]Entry, error) {
+		return entries, s.load(ctx, tempName, entries)
+	}, opts...)
+}
+
+// replace fills a temporary set with load and swaps it with s, holding the
+// locks of the set meanwhile. The entries load returns become the desired
+// content of s. Single-entry mutations, such as an urgent Add, are not held
+// up by the load: they go to the live set and are replayed into the
+// temporary set before the swap, so they only wait for the swap itself.
+// Emptying a protected set needs Force.
+func (s *IPSet) replace(load func(tempName string) ([]Entry, error), opts ...ForceOption) error {
+	if err := s.writable(); err != nil {
 		return err
 	}
-	err = destroyIPSet(tempName)
+	st := stateOf(s.Name)
+	st.replacing.Lock()
+	unlock, err := lockSets(s.Locker, s.Name)
 	if err != nil {
+		st.replacing.Unlock()
+		return fmt.Errorf("error locking set %s: %v", s.Name, err)
+	}
+	prev, entries, err := s.replaceLocked(st, load, opts)
+	unlock()
+	st.replacing.Unlock()
+	if err != nil || activePlan(s.DryRun) != nil {
 		return err
 	}
+	s.mu.Lock()
+	s.desired, s.added, s.deleted = entries, nil, nil
+	s.bump()
+	onRefresh, onChange := s.onRefresh, s.onChange
+	s.mu.Unlock()
+	publish(Event{Type: SetRefreshed, Set: s.Name})
+	for _, fn := range onRefresh {
+		fn(s)
+	}
+	if len(onChange) > 0 {
+		values := make([]string, len(entries))
+		for i, e := range entries {
+			values[i] = e.Value
+		}
+		s.changed(diffEntries(s.HashType, prev, values))
+	}
+	return nil
+}
+
+// replaceLocked does the work of replace with the locks of the set held
+// and returns the previous members when there are change hooks.
+func (s *IPSet) replaceLocked(st *setState, load func(tempName string) ([]Entry, error), opts []ForceOption) ([]string, []Entry, error) {
+	st.startJournal()
+	defer st.stopJournal()
+	var prev []string
+	if s.hasChangeHooks() && activePlan(s.DryRun) == nil {
+		// a missing set simply had no members
+		prev, _ = s.members()
+	}
+	var foreign []Entry
+	if s.Owner != "" && activePlan(s.DryRun) == nil {
+		// a missing set simply had no foreign entries
+		foreign, _ = s.foreign()
+	}
+	tempName, err := s.stagingName(s.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.createHashSet(tempName)
+	if err != nil {
+		return nil, nil, err
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			// a staging set left behind would block the next replace
+			destroyIPSet(s.DryRun, tempName)
+		}
+	}()
+	entries, err := load(tempName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.keepForeign(tempName, foreign); err != nil {
+		return nil, nil, err
+	}
+	if err := s.guardRefresh(tempName, opts); err != nil {
+		return nil, nil, err
+	}
+	st.Lock()
+	err = s.replay(tempName, st.stopJournal())
+	if err == nil {
+		err = swap(s.DryRun, tempName, s.Name)
+	}
+	st.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	swapped = true
+	return prev, entries, destroyIPSet(s.DryRun, tempName)
+}
+
+// load adds entries to the set name, reporting failures in a *BatchError.
+// It stops when ctx is done.
+func (s *IPSet) load(ctx context.Context, name string, entries []Entry) error {
+	if s.Pacing.ChunkSize > 0 {
+		c := &chunker{s: s}
+		for i, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return s.canceled(i, len(entries), err)
+			}
+			e.Timeout = s.entryTimeout(e)
+			e.Comment = s.tagComment(e.Comment)
+			if err := c.add(addLine(name, e)); err != nil {
+				return s.chunkError(name, err)
+			}
+		}
+		return s.chunkError(name, c.flush())
+	}
+	var batch BatchError
+	for i, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return s.canceled(i, len(entries), err)
+		}
+		e.Timeout = s.entryTimeout(e)
+		e.Comment = s.tagComment(e.Comment)
+		args := append([]string{"add", name, e.Value}, e.args()...)
+		out, err := s.mutate(append(args, "-exist")...)
+		if full := s.fullError(name, err); full != nil {
+			// the remaining entries would not fit either
+			batch.add(e.Value, full)
+			break
+		} else if err != nil {
+			batch.add(e.Value, fmt.Errorf("error adding entry %s to set %s: %w (%s)", e.Value, name, err, out))
+		}
+	}
+	return batch.err()
+}
+
+var (
+	setLocksMu sync.Mutex
+	setLocks   = make(map[string]*setState)
+)
+
+// setState coordinates the commands of this process on one set.
+type setState struct {
+	// RWMutex is held for reading by single-entry commands and for
+	// writing by commands swapping in or removing the set.
+	sync.RWMutex
+	// replacing serializes the replaces of the set.
+	replacing sync.Mutex
+
+	journalMu sync.Mutex
+	// journal, while a replace loads its staging set, collects the
+	// single-entry mutations of the live set to replay them there.
+	journal *[][]string
+}
+
+func stateOf(name string) *setState {
+	setLocksMu.Lock()
+	defer setLocksMu.Unlock()
+	st, ok := setLocks[name]
+	if !ok {
+		st = new(setState)
+		setLocks[name] = st
+	}
+	return st
+}
+
+// setLock returns the lock serializing the commands of this process on the
+// named set: single-entry commands hold it for reading, commands swapping
+// in or removing the set for writing.
+func setLock(name string) *sync.RWMutex {
+	return &stateOf(name).RWMutex
+}
+
+// startJournal starts collecting the single-entry mutations of the set.
+func (st *setState) startJournal() {
+	st.journalMu.Lock()
+	st.journal = new([][]string)
+	st.journalMu.Unlock()
+}
+
+// stopJournal stops collecting and returns the mutations collected.
+func (st *setState) stopJournal() [][]string {
+	st.journalMu.Lock()
+	defer st.journalMu.Unlock()
+	if st.journal == nil {
+		return nil
+	}
+	ops := *st.journal
+	st.journal = nil
+	return ops
+}
+
+// logMutation adds a successful single-entry mutation to the journal, if
+// one is being collected. The read lock of the set must be held.
+func (st *setState) logMutation(args []string) {
+	st.journalMu.Lock()
+	if st.journal != nil {
+		*st.journal = append(*st.journal, slices.Clone(args))
+	}
+	st.journalMu.Unlock()
+}
+
+// replay applies the journaled mutations ops of s to its staging set
+// tempName.
+func (s *IPSet) replay(tempName string, ops [][]string) error {
+	for _, args := range ops {
+		args = slices.Clone(args)
+		// single-entry mutations are "add"/"del", set, entry, options
+		args[1] = tempName
+		if args[len(args)-1] != "-exist" {
+			args = append(args, "-exist")
+		}
+		if out, err := s.mutate(args...); err != nil {
+			return fmt.Errorf("error replaying %s of %s into %s: %w (%s)", args[0], args[2], tempName, err, out)
+		}
+	}
 	return nil
 }
 
+// Generation returns a counter bumped by every successful Refresh, and
+// every successful Sync changing the set, through this handle, and the
+// time of the last bump. Callers
+// compare it with a previously seen value to learn whether anything may
+// have changed.
+func (s *IPSet) Generation() (gen uint64, changed time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generation, s.changedAt
+}
+
+// bump is called with s.mu held.
+func (s *IPSet) bump() {
+	s.generation++
+	s.changedAt = time.Now()
+}
+
+// OnChange registers fn to be called with the entries added and deleted by
+// each successful Add, Del or Refresh of the set through this handle.
+func (s *IPSet) OnChange(fn func(added, deleted []string)) {
+	s.mu.Lock()
+	s.onChange = append(s.onChange, fn)
+	s.mu.Unlock()
+}
+
+func (s *IPSet) hasChangeHooks() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.onChange) > 0
+}
+
+func (s *IPSet) changed(added, deleted []string) {
+	if activePlan(s.DryRun) != nil || len(added) == 0 && len(deleted) == 0 {
+		return
+	}
+	s.mu.Lock()
+	onChange := s.onChange
+	s.mu.Unlock()
+	for _, fn := range onChange {
+		fn(added, deleted)
+	}
+}
+
+// OnRefresh registers fn to be called after each successful Refresh of the
+// set through this handle.
+func (s *IPSet) OnRefresh(fn func(s *IPSet)) {
+	s.mu.Lock()
+	s.onRefresh = append(s.onRefresh, fn)
+	s.mu.Unlock()
+}
 
 func (s *IPSet) Test(entry string) (bool, error) {
-	out, err := exec.Command(ipsetPath, "test", s.Name, entry).CombinedOutput()
+	out, err := combinedOutput("test", s.Name, entry)
 	if err == nil {
 		reg, e := regexp.Compile("NOT")
 		if e == nil && reg.MatchString(string(out)) {
@@ -123,59 +606,209 @@ func (s *IPSet) Test(entry string) (bool, error) {
 		} else {
 			return false, fmt.Errorf("error testing entry %s: %v", entry, e)
 		}
+	} else if strings.Contains(string(out), "is NOT in set") {
+		// ipset test exits non-zero for entries missing from the set
+		return false, nil
 	} else {
-		return false, fmt.Errorf("error testing entry %s: %v (%s)", entry, err, out)
+		return false, fmt.Errorf("error testing entry %s: %w (%s)", entry, err, out)
 	}
 }
 
-func (s *IPSet) Add(entry string, timeout int) error {
-	out, err := exec.Command(ipsetPath, "add", s.Name, entry, "timeout", strconv.Itoa(timeout), "-exist").CombinedOutput()
+// TestMany checks a batch of entries with a single listing of the set instead
+// of running ipset once per entry. Net types are matched CIDR-aware and, as
+// by ipset test, an entry whose most specific match is a nomatch entry is
+// not in the set.
+func (s *IPSet) TestMany(entries []string) (map[string]bool, error) {
+	list, err := s.entries()
 	if err != nil {
-		return fmt.Errorf("error adding entry %s: %v (%s)", entry, err, out)
+		return nil, err
 	}
-	return nil
+	members := make(map[string]bool, len(list))
+	for _, e := range list {
+		members[canonical(s.HashType, e.Value)] = !e.NoMatch
+	}
+	res := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		res[entry] = matchMember(s.HashType, members, entry)
+	}
+	return res, nil
 }
 
+// matchMember reports whether entry matches a set of type hashType whose
+// canonical members map to false for nomatch entries. In hash:net sets the
+// most specific network containing entry decides, as in the kernel.
+func matchMember(hashType string, members map[string]bool, entry string) bool {
+	if match, ok := members[canonical(hashType, entry)]; ok {
+		return match
+	}
+	if !isNetType(hashType) {
+		return false
+	}
+	p, ok := parsePrefix(entry)
+	if !ok {
+		return false
+	}
+	for bits := p.Bits() - 1; bits >= 0; bits-- {
+		if match, ok := members[netip.PrefixFrom(p.Addr(), bits).Masked().String()]; ok {
+			return match
+		}
+	}
+	return false
+}
 
-func (s *IPSet) Del(entry string) error {
-	out, err := exec.Command(ipsetPath, "del", s.Name, entry, "-exist").CombinedOutput()
+// Add adds entry to the set with a timeout in seconds; opts set further
+// per-entry options. A zero timeout keeps the entry until it is deleted
+// in a set with timeouts, whatever s.Defaults.Timeout and the default
+// timeout of the set; use AddEntry to apply those.
+func (s *IPSet) Add(entry string, timeout int, opts ...AddOption) error {
+	e := Entry{Value: entry, Timeout: time.Duration(timeout) * time.Second}
+	for _, opt := range opts {
+		opt(&e)
+	}
+	if e.Timeout == 0 && (s.Timeout > 0 || s.TimeoutExt) {
+		e.Permanent = true
+	}
+	return s.AddEntry(e)
+}
+
+// AddMany adds entries to the set with the given timeout, as Add does. All
+// entries are attempted; failures are reported in a *BatchError.
+func (s *IPSet) AddMany(entries []string, timeout int) error {
+	var batch BatchError
+	for _, entry := range entries {
+		batch.add(entry, s.Add(entry, timeout))
+	}
+	return batch.err()
+}
+
+// AddEntry adds e to the set, filling unset options from s.Defaults.
+func (s *IPSet) AddEntry(e Entry) error {
+	return s.AddExist(e, s.Defaults.Exist)
+}
+
+// AddExist adds e like AddEntry, with policy deciding whether adding an
+// entry already present fails with ErrEntryExists.
+func (s *IPSet) AddExist(e Entry, policy ExistPolicy) error {
+	opts, err := s.entryArgs(e)
+	if err != nil {
+		return fmt.Errorf("error adding entry %s to set %s: %w", e.Value, s.Name, err)
+	}
+	args := append([]string{"add", s.Name, e.Value}, opts...)
+	if policy == ExistIgnore {
+		args = append(args, "-exist")
+	}
+	out, err := s.mutateShared(args...)
 	if err != nil {
-		return fmt.Errorf("error deleting entry %s: %v (%s)", entry, err, out)
+		if strings.Contains(string(out), "it's already added") {
+			return fmt.Errorf("%w: %s in set %s", ErrEntryExists, e.Value, s.Name)
+		}
+		if full := s.fullError(s.Name, err); full != nil {
+			return full
+		}
+		return fmt.Errorf("error adding entry %s: %w (%s)", e.Value, err, out)
+	}
+	s.track(e, true)
+	s.changed([]string{e.Value}, nil)
+	if s.Conntrack&ConntrackOnAdd != 0 {
+		s.dropConntrack(e.Value)
 	}
 	return nil
 }
 
+// Del deletes entry from the set. Deleting an entry that is not present
+// fails with ErrEntryNotFound when s.Defaults.Exist is ExistFail.
+func (s *IPSet) Del(entry string) error {
+	return s.DelExist(entry, s.Defaults.Exist)
+}
 
-func (s *IPSet) Flush() error {
-	out, err := exec.Command(ipsetPath, "flush", s.Name).CombinedOutput()
+// DelExist deletes entry like Del, with policy deciding whether deleting an
+// entry that is not present fails with ErrEntryNotFound.
+func (s *IPSet) DelExist(entry string, policy ExistPolicy) error {
+	args := []string{"del", s.Name, entry}
+	if policy == ExistIgnore {
+		args = append(args, "-exist")
+	}
+	out, err := s.mutateShared(args...)
 	if err != nil {
-		return fmt.Errorf("error flushing set %s: %v (%s)", s.Name, err, out)
+		if strings.Contains(string(out), "it's not added") {
+			return fmt.Errorf("%w: %s in set %s", ErrEntryNotFound, entry, s.Name)
+		}
+		return fmt.Errorf("error deleting entry %s: %w (%s)", entry, err, out)
+	}
+	s.track(Entry{Value: entry}, false)
+	s.changed(nil, []string{entry})
+	if s.Conntrack&ConntrackOnDel != 0 {
+		s.dropConntrack(entry)
 	}
 	return nil
 }
 
+// Flush removes every entry from the set. A protected set needs Force.
+func (s *IPSet) Flush(opts ...ForceOption) error {
+	if err := s.guard("flush", opts); err != nil {
+		return err
+	}
+	l := setLock(s.Name)
+	l.Lock()
+	out, err := s.mutate("flush", s.Name)
+	l.Unlock()
+	if err != nil {
+		return fmt.Errorf("error flushing set %s: %w (%s)", s.Name, err, out)
+	}
+	return nil
+}
 
-func (s *IPSet) Destroy() error {
-	out, err := exec.Command(ipsetPath, "destroy", s.Name).CombinedOutput()
+// Destroy removes the set. A protected set needs Force.
+func (s *IPSet) Destroy(opts ...ForceOption) error {
+	if err := s.guard("destroy", opts); err != nil {
+		return err
+	}
+	l := setLock(s.Name)
+	l.Lock()
+	out, err := s.mutate("destroy", s.Name)
+	l.Unlock()
 	if err != nil {
-		return fmt.Errorf("error destroying set %s: %v (%s)", s.Name, err, out)
+		return fmt.Errorf("error destroying set %s: %w (%s)", s.Name, err, out)
 	}
 	return nil
 }
 
 // Swap is used to hot swap two sets on-the-fly. Use with names of existing sets of the same type.
+// It holds the Locker set with SetLocker, if any.
 func Swap(from, to string) error {
-	out, err := exec.Command(ipsetPath, "swap", from, to).Output()
+	unlock, err := lockSets(nil, from, to)
+	if err != nil {
+		return fmt.Errorf("error locking sets %s and %s: %v", from, to, err)
+	}
+	defer unlock()
+	return swap(nil, from, to)
+}
+
+func swap(p *Plan, from, to string) error {
+	out, err := mutate(p, "swap", from, to)
 	if err != nil {
-		return fmt.Errorf("error swapping ipset %s to %s: %v (%s)", from, to, err, out)
+		return fmt.Errorf("error swapping ipset %s to %s: %w (%s)", from, to, err, out)
 	}
 	return nil
 }
 
-func destroyIPSet(name string) error {
-	out, err := exec.Command(ipsetPath, "destroy", name).Output()
+func destroyIPSet(p *Plan, name string) error {
+	out, err := mutate(p, "destroy", name)
 	if err != nil {
-		return fmt.Errorf("error destroying ipset %s: %v (%s)", name, err, out)
+		return fmt.Errorf("error destroying ipset %s: %w (%s)", name, err, out)
 	}
 	return nil
 }
+
+// parsePrefix accepts either a plain address or a CIDR and returns it as a
+// masked prefix.
+func parsePrefix(v string) (netip.Prefix, bool) {
+	if a, err := netip.ParseAddr(v); err == nil {
+		return netip.PrefixFrom(a, a.BitLen()), true
+	}
+	p, err := netip.ParsePrefix(v)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return p.Masked(), true
+}
@@ -0,0 +1,139 @@
+package go_ipset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRequiredMissing is returned when a refresh of a guarded allowlist would
+// drop one of its required entries.
+var ErrRequiredMissing = errors.New("required allowlist entry missing")
+
+// AllowlistGuard manages an allowlist set that must always contain a set of
+// required entries, such as operator bastion addresses.
+type AllowlistGuard struct {
+	Set      *IPSet
+	Required []string
+
+	// FailOpenAfter, when non-zero, makes Run flush the set once no
+	// Refresh or Heartbeat succeeded for that long.
+	FailOpenAfter time.Duration
+	// OnFailOpen is called after Run flushed the set; it may be nil.
+	OnFailOpen func(err error)
+	// OnError receives the errors of Run restoring the required entries;
+	// it may be nil.
+	OnError func(error)
+
+	mu          sync.Mutex
+	lastContact time.Time
+	failedOpen  bool
+}
+
+// NewAllowlistGuard returns a guard for set that keeps required in it.
+func NewAllowlistGuard(set *IPSet, required []string) *AllowlistGuard {
+	return &AllowlistGuard{Set: set, Required: required, lastContact: time.Now()}
+}
+
+// Refresh replaces the allowlist with entries, refusing with
+// ErrRequiredMissing if they don't cover every required entry.
+func (g *AllowlistGuard) Refresh(entries []string) error {
+	for _, r := range g.Required {
+		if !covers(g.Set.HashType, entries, r) {
+			return fmt.Errorf("%w: %s", ErrRequiredMissing, r)
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.Set.Refresh(entries); err != nil {
+		return err
+	}
+	g.lastContact = time.Now()
+	g.failedOpen = false
+	return nil
+}
+
+// Ensure adds any required entries missing from the live set.
+func (g *AllowlistGuard) Ensure() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failedOpen {
+		return nil
+	}
+	members, err := g.Set.members()
+	if err != nil {
+		return err
+	}
+	for _, r := range g.Required {
+		if covers(g.Set.HashType, members, r) {
+			continue
+		}
+		if err := g.Set.AddEntry(Entry{Value: r}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Heartbeat records that the control plane is reachable without a refresh.
+func (g *AllowlistGuard) Heartbeat() {
+	g.mu.Lock()
+	g.lastContact = time.Now()
+	g.mu.Unlock()
+}
+
+// Run enforces the required entries and the fail-open policy every
+// interval until ctx is done.
+func (g *AllowlistGuard) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("allowlist guard interval %v is not positive", interval)
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		g.checkFailOpen()
+		if err := g.Ensure(); err != nil && g.OnError != nil {
+			g.OnError(err)
+		}
+	}
+}
+
+func (g *AllowlistGuard) checkFailOpen() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.FailOpenAfter == 0 || g.failedOpen || time.Since(g.lastContact) < g.FailOpenAfter {
+		return
+	}
+	err := g.Set.Flush()
+	if err == nil {
+		g.failedOpen = true
+	}
+	if g.OnFailOpen != nil {
+		g.OnFailOpen(err)
+	}
+}
+
+// covers reports whether entry is among members, or for net types lies
+// within one of them.
+func covers(hashType string, members []string, entry string) bool {
+	c := canonical(hashType, entry)
+	p, isPrefix := parsePrefix(entry)
+	for _, m := range members {
+		if canonical(hashType, m) == c {
+			return true
+		}
+		if isPrefix && isNetType(hashType) {
+			if q, ok := parsePrefix(m); ok && q.Bits() <= p.Bits() && q.Contains(p.Addr()) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package go_ipset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// probeEntry is the documentation address HealthCheck adds to its probe.
+const probeEntry = "192.0.2.1"
+
+// HealthCheck verifies end to end that sets can be managed: it creates a
+// small probe set, adds, tests and deletes an entry, and destroys the set
+// again. It fails if the ipset utility, the kernel modules or the
+// permissions needed are missing. ctx is checked between the steps.
+func HealthCheck(ctx context.Context) (err error) {
+	if err := initCheck(); err != nil {
+		return err
+	}
+	probe := &IPSet{
+		Name:       fmt.Sprintf("goipset-probe-%d", os.Getpid()),
+		HashType:   TypeHashIP,
+		HashFamily: FamilyInet,
+		MaxElem:    16,
+		HashSize:   64,
+	}
+	if err := probe.create(probe.Name); err != nil {
+		return fmt.Errorf("health check: %w", err)
+	}
+	defer func() {
+		if derr := probe.Destroy(); derr != nil && err == nil {
+			err = fmt.Errorf("health check: %w", derr)
+		}
+	}()
+	steps := []func() error{
+		func() error { return probe.AddEntry(Entry{Value: probeEntry}) },
+		func() error {
+			ok, err := probe.Test(probeEntry)
+			if err == nil && !ok {
+				err = errors.New("probe entry missing after add")
+			}
+			return err
+		},
+		func() error { return probe.Del(probeEntry) },
+	}
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := step(); err != nil {
+			return fmt.Errorf("health check: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package go_ipset
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// RefreshFromFile replaces the contents of the set with the entries listed
+// in the file at path, see ReadEntries for the format.
+func (s *IPSet) RefreshFromFile(path string, opts ...ForceOption) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	entries, err := s.readEntries(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return s.Refresh(entries, opts...)
+}
+
+// RefreshFromReader replaces the contents of the set with the entries read
+// from r, see ReadEntries for the format, streaming them into ipset restore
+// instead of holding them in memory, for feeds too large for that. A line
+// may carry entry options after the value, e.g. "10.0.0.1 timeout 300". The
+// set is left as it was if any line is invalid. Unless OnChange hooks are
+// registered the entries are not kept, so Guard recreates the set empty.
+// Emptying a protected set needs Force.
+func (s *IPSet) RefreshFromReader(r io.Reader, opts ...ForceOption) error {
+	return s.RefreshFromReaderContext(context.Background(), r, opts...)
+}
+
+// RefreshFromReaderContext is RefreshFromReader giving up once ctx is done,
+// as RefreshContext does. r is not read any further then, but a read
+// already blocked in r is waited for.
+func (s *IPSet) RefreshFromReaderContext(ctx context.Context, r io.Reader, opts ...ForceOption) error {
+	keep := s.hasChangeHooks()
+	return s.replace(func(tempName string) ([]Entry, error) {
+		var entries []Entry
+		loaded := 0
+		// scan passes emit the restore line of each entry read from r
+		scan := func(emit func(line string) error) error {
+			return scanEntries(r, func(n int, line string) error {
+				if err := ctx.Err(); err != nil {
+					return s.canceled(loaded, -1, err)
+				}
+				fields := splitFields(line)
+				if err := s.validEntry(fields[0]); err != nil {
+					return fmt.Errorf("line %d: %v", n, err)
+				}
+				e := parseEntry(fields[0], fields[1:])
+				if err := checkTimeout(e.Timeout); err != nil {
+					return fmt.Errorf("line %d: %w", n, err)
+				}
+				if keep {
+					entries = append(entries, e)
+				}
+				loaded++
+				if s.Owner != "" {
+					e.Comment = s.tagComment(e.Comment)
+					return emit(addLine(tempName, e))
+				}
+				return emit("add " + tempName + " " + line)
+			})
+		}
+		if s.Pacing.ChunkSize > 0 {
+			c := &chunker{s: s}
+			err := scan(c.add)
+			if err == nil {
+				err = c.flush()
+			}
+			return entries, s.chunkError(tempName, err)
+		}
+		pr, pw := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			bw := bufio.NewWriter(pw)
+			err := scan(func(line string) error {
+				_, err := bw.WriteString(line + "\n")
+				return err
+			})
+			if err == nil {
+				err = bw.Flush()
+			}
+			pw.CloseWithError(err)
+			done <- err
+		}()
+		err := restore(s.DryRun, pr, "-exist")
+		// stops the reading of r when restore gave up early
+		pr.Close()
+		if scanErr := <-done; scanErr != nil && scanErr != io.ErrClosedPipe {
+			return nil, scanErr
+		}
+		return entries, s.chunkError(tempName, err)
+	}, opts...)
+}
+
+// AddFromReader adds the entries read from r to the set, see ReadEntries for
+// the format, using s.Defaults for their options. Nothing is added if any
+// line is invalid.
+func (s *IPSet) AddFromReader(r io.Reader) error {
+	entries, err := s.readEntries(r)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.AddEntry(Entry{Value: entry}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadEntries reads one entry per line from r. Blank lines are skipped and
+// everything after a # is treated as a comment.
+func ReadEntries(r io.Reader) ([]string, error) {
+	var entries []string
+	err := scanEntries(r, func(n int, entry string) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+func (s *IPSet) readEntries(r io.Reader) ([]string, error) {
+	var entries []string
+	err := scanEntries(r, func(n int, entry string) error {
+		if err := s.validEntry(entry); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+func scanEntries(r io.Reader, fn func(n int, entry string) error) error {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := fn(n, line); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// validEntry checks the leading dimension of entry against the set type
+// and family.
+func (s *IPSet) validEntry(entry string) error {
+	first := strings.SplitN(entry, ",", 2)[0]
+	switch {
+	case strings.HasPrefix(s.HashType, "hash:ip") || strings.HasPrefix(s.HashType, "hash:net"):
+		p, ok := parsePrefix(first)
+		if !ok && strings.Contains(first, "-") {
+			// ipset accepts from-to ranges
+			parts := strings.SplitN(first, "-", 2)
+			p, ok = parsePrefix(parts[0])
+			if _, ok2 := parsePrefix(parts[1]); !ok2 {
+				ok = false
+			}
+		}
+		if !ok {
+			return fmt.Errorf("invalid address %q", first)
+		}
+		if p.Addr().Is4() != (s.HashFamily != FamilyInet6) {
+			return fmt.Errorf("address %s does not match family %s", first, s.HashFamily)
+		}
+	case s.HashType == TypeHashMAC:
+		if _, err := net.ParseMAC(first); err != nil {
+			return fmt.Errorf("invalid MAC address %q", first)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package go_ipset
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// maxChainLen is the longest chain name iptables accepts.
+const maxChainLen = 28
+
+// RuleBinding maintains a dedicated iptables chain that logs and drops (or
+// rejects) traffic matching a set, jumped to from a parent chain. For inet6
+// sets ip6tables is used.
+type RuleBinding struct {
+	Set *IPSet
+	// Chain defaults to "IPSET-" followed by the set name.
+	Chain string
+	// Parent defaults to INPUT, Table to filter.
+	Parent string
+	Table  string
+	// Target defaults to DROP; use REJECT to reject instead.
+	Target string
+	// LogPrefix adds a LOG rule in front of the target rule when set.
+	LogPrefix string
+	// Direction is the set match direction, "src" by default.
+	Direction string
+}
+
+func (b *RuleBinding) defaults() (chain, parent, table, target, dir string) {
+	chain, parent, table, target, dir = b.Chain, b.Parent, b.Table, b.Target, b.Direction
+	if chain == "" {
+		chain = "IPSET-" + b.Set.Name
+	}
+	if parent == "" {
+		parent = "INPUT"
+	}
+	if table == "" {
+		table = "filter"
+	}
+	if target == "" {
+		target = "DROP"
+	}
+	if dir == "" {
+		dir = "src"
+	}
+	return
+}
+
+// iptables runs the iptables tool of the family of the set, waiting for
+// the xtables lock held by other processes rather than failing.
+func (b *RuleBinding) iptables(args ...string) ([]byte, error) {
+	tool := "iptables"
+	if b.Set.HashFamily == FamilyInet6 {
+		tool = "ip6tables"
+	}
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return nil, fmt.Errorf("%s utility not found", tool)
+	}
+	return exec.Command(path, append([]string{"-w"}, args...)...).CombinedOutput()
+}
+
+// Install creates or rebuilds the chain and makes sure the parent chain
+// jumps to it. It can be called repeatedly. The rules of an existing chain
+// are replaced one by one, so the chain never goes empty in between.
+func (b *RuleBinding) Install() error {
+	chain, parent, table, target, dir := b.defaults()
+	if len(chain) > maxChainLen {
+		return fmt.Errorf("chain name %s longer than %d characters", chain, maxChainLen)
+	}
+	have := 0
+	if _, err := b.iptables("-t", table, "-N", chain); err != nil {
+		// the chain may exist already; listing it tells
+		n, out, err := b.ruleCount(table, chain)
+		if err != nil {
+			return fmt.Errorf("error preparing chain %s: %v (%s)", chain, err, out)
+		}
+		have = n
+	}
+	match := []string{"-m", "set", "--match-set", b.Set.Name, dir}
+	var rules [][]string
+	if b.LogPrefix != "" {
+		rules = append(rules, append(append([]string(nil), match...), "-j", "LOG", "--log-prefix", b.LogPrefix))
+	}
+	rules = append(rules, append(match, "-j", target))
+	for i, rule := range rules {
+		args := []string{"-t", table, "-A", chain}
+		if i < have {
+			args = []string{"-t", table, "-R", chain, strconv.Itoa(i + 1)}
+		}
+		if out, err := b.iptables(append(args, rule...)...); err != nil {
+			return fmt.Errorf("error setting rule %d of chain %s: %v (%s)", i+1, chain, err, out)
+		}
+	}
+	for n := have; n > len(rules); n-- {
+		if out, err := b.iptables("-t", table, "-D", chain, strconv.Itoa(n)); err != nil {
+			return fmt.Errorf("error deleting rule %d of chain %s: %v (%s)", n, chain, err, out)
+		}
+	}
+	if _, err := b.iptables("-t", table, "-C", parent, "-j", chain); err == nil {
+		return nil
+	}
+	if out, err := b.iptables("-t", table, "-I", parent, "1", "-j", chain); err != nil {
+		return fmt.Errorf("error jumping from %s to %s: %v (%s)", parent, chain, err, out)
+	}
+	return nil
+}
+
+// ruleCount returns the number of rules in chain, and the output of the
+// listing for errors.
+func (b *RuleBinding) ruleCount(table, chain string) (int, []byte, error) {
+	out, err := b.iptables("-t", table, "-S", chain)
+	if err != nil {
+		return 0, out, err
+	}
+	n := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "-A ") {
+			n++
+		}
+	}
+	return n, out, nil
+}
+
+// Installed reports whether the chain of the binding exists.
+func (b *RuleBinding) Installed() bool {
+	chain, _, table, _, _ := b.defaults()
+	_, err := b.iptables("-t", table, "-S", chain)
+	return err == nil
+}
+
+// Remove deletes the jump and the chain, so the set is no longer
+// referenced and can be destroyed.
+func (b *RuleBinding) Remove() error {
+	chain, parent, table, _, _ := b.defaults()
+	for {
+		if _, err := b.iptables("-t", table, "-D", parent, "-j", chain); err != nil {
+			break
+		}
+	}
+	if out, err := b.iptables("-t", table, "-F", chain); err != nil {
+		return fmt.Errorf("error flushing chain %s: %v (%s)", chain, err, out)
+	}
+	if out, err := b.iptables("-t", table, "-X", chain); err != nil {
+		return fmt.Errorf("error deleting chain %s: %v (%s)", chain, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package go_ipset
+
+import (
+	"bytes"
+	"iter"
+)
+
+// All returns an iterator over the members of the set with their options.
+// The set is read when iteration starts and each member is parsed as it is
+// yielded, which spares building a slice of all entries. The listing
+// itself is read in full first, as backends return the whole output of a
+// command, so it still takes memory in proportion to the set. Iteration
+// ends early when the set cannot be read; use AllErr to learn why.
+func (s *IPSet) All() iter.Seq[Entry] {
+	return func(yield func(Entry) bool) {
+		for e, err := range s.AllErr() {
+			if err != nil || !yield(e) {
+				return
+			}
+		}
+	}
+}
+
+// AllErr is like All, but yields the error of reading the set, if any, as
+// its only element.
+func (s *IPSet) AllErr() iter.Seq2[Entry, error] {
+	return func(yield func(Entry, error) bool) {
+		out, err := s.save()
+		if err != nil {
+			yield(Entry{}, err)
+			return
+		}
+		for len(out) > 0 {
+			var line []byte
+			line, out, _ = bytes.Cut(out, []byte{'\n'})
+			fields := splitFields(string(line))
+			if len(fields) >= 3 && fields[0] == "add" {
+				if !yield(parseEntry(fields[2], fields[3:]), nil) {
+					return
+				}
+			}
+		}
+	}
+}
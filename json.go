@@ -0,0 +1,238 @@
+package go_ipset
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonMinVersion is the first ipset release with -output json.
+var jsonMinVersion = [2]int{7, 11}
+
+var versionRe = regexp.MustCompile(`v(\d+)\.(\d+)`)
+
+// ipsetVersion caches Version for the backend in use; guarded by backendMu.
+var ipsetVersion *[2]int
+
+// Version returns the major and minor version of the ipset utility.
+func Version() (major, minor int, err error) {
+	if err := initCheck(); err != nil {
+		return 0, 0, err
+	}
+	backendMu.Lock()
+	v := ipsetVersion
+	backendMu.Unlock()
+	if v == nil {
+		out, err := combinedOutput("version")
+		if err != nil {
+			return 0, 0, fmt.Errorf("error getting ipset version: %w (%s)", err, out)
+		}
+		m := versionRe.FindSubmatch(out)
+		if m == nil {
+			return 0, 0, fmt.Errorf("error parsing ipset version: %s", out)
+		}
+		major, _ := strconv.Atoi(string(m[1]))
+		minor, _ := strconv.Atoi(string(m[2]))
+		v = &[2]int{major, minor}
+		backendMu.Lock()
+		ipsetVersion = v
+		backendMu.Unlock()
+	}
+	return v[0], v[1], nil
+}
+
+func jsonSupported() bool {
+	major, minor, err := Version()
+	if err != nil {
+		return false
+	}
+	return major > jsonMinVersion[0] || major == jsonMinVersion[0] && minor >= jsonMinVersion[1]
+}
+
+type jsonIPSet struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	Revision int        `json:"revision"`
+	Header   jsonHeader `json:"header"`
+	Members  []jsonElem `json:"members"`
+}
+
+type jsonHeader struct {
+	Family     string   `json:"family"`
+	HashSize   int      `json:"hashsize"`
+	MaxElem    int      `json:"maxelem"`
+	Timeout    int      `json:"timeout"`
+	Counters   jsonFlag `json:"counters"`
+	Comment    jsonFlag `json:"comment"`
+	SkbInfo    jsonFlag `json:"skbinfo"`
+	ForceAdd   jsonFlag `json:"forceadd"`
+	MemSize    int      `json:"memsize"`
+	References int      `json:"references"`
+	NumEntries int      `json:"numentries"`
+}
+
+type jsonElem struct {
+	Elem     string   `json:"elem"`
+	Timeout  int      `json:"timeout"`
+	Packets  uint64   `json:"packets"`
+	Bytes    uint64   `json:"bytes"`
+	Comment  string   `json:"comment"`
+	SkbMark  jsonText `json:"skbmark"`
+	SkbPrio  jsonText `json:"skbprio"`
+	SkbQueue jsonText `json:"skbqueue"`
+	NoMatch  jsonFlag `json:"nomatch"`
+}
+
+// jsonFlag is set when ipset emits the key at all, whatever its value,
+// unless the value is an explicit false.
+type jsonFlag bool
+
+func (f *jsonFlag) UnmarshalJSON(data []byte) error {
+	*f = jsonFlag(!bytes.Equal(data, []byte("false")))
+	return nil
+}
+
+// jsonText accepts both strings and bare numbers, as ipset versions differ
+// in how they print skbinfo values.
+type jsonText string
+
+func (t *jsonText) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var v string
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*t = jsonText(v)
+		return nil
+	}
+	*t = jsonText(data)
+	return nil
+}
+
+// listJSON runs ipset list -output json with args and parses the result.
+func listJSON(args ...string) ([]SetInfo, error) {
+	args = append([]string{"list", "-output", "json"}, args...)
+	out, err := output(args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing ipset %s: %w (%s)", strings.Join(args[3:], " "), err, out)
+	}
+	return parseJSON(out)
+}
+
+func parseJSON(data []byte) ([]SetInfo, error) {
+	var doc []jsonIPSet
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing ipset json output: %v", err)
+	}
+	sets := make([]SetInfo, len(doc))
+	for i, x := range doc {
+		h := x.Header
+		sets[i] = SetInfo{
+			Name:       x.Name,
+			Type:       x.Type,
+			Revision:   x.Revision,
+			Family:     h.Family,
+			HashSize:   h.HashSize,
+			MaxElem:    h.MaxElem,
+			Timeout:    h.Timeout,
+			Counters:   bool(h.Counters),
+			Comment:    bool(h.Comment),
+			SkbInfo:    bool(h.SkbInfo),
+			ForceAdd:   bool(h.ForceAdd),
+			MemSize:    h.MemSize,
+			References: h.References,
+			NumEntries: h.NumEntries,
+		}
+		for _, m := range x.Members {
+			e := Entry{
+				Value:   m.Elem,
+				Timeout: time.Duration(m.Timeout) * time.Second,
+				Comment: strings.Trim(m.Comment, `"`),
+				Packets: m.Packets,
+				Bytes:   m.Bytes,
+				NoMatch: bool(m.NoMatch),
+			}
+			e.setSkb("skbmark", string(m.SkbMark))
+			e.setSkb("skbprio", string(m.SkbPrio))
+			e.setSkb("skbqueue", string(m.SkbQueue))
+			sets[i].Members = append(sets[i].Members, e)
+		}
+	}
+	return sets, nil
+}
+
+type jsonEntry struct {
+	Value     string `json:"value"`
+	Timeout   int    `json:"timeout,omitempty"`
+	Permanent bool   `json:"permanent,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	Packets   uint64 `json:"packets,omitempty"`
+	Bytes     uint64 `json:"bytes,omitempty"`
+	SkbMark   string `json:"skbmark,omitempty"`
+	SkbPrio   string `json:"skbprio,omitempty"`
+	SkbQueue  string `json:"skbqueue,omitempty"`
+	NoMatch   bool   `json:"nomatch,omitempty"`
+	Hostname  string `json:"hostname,omitempty"`
+}
+
+// MarshalJSON encodes the entry with its timeout in whole seconds.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	mark, prio, queue := e.skbStrings()
+	return json.Marshal(jsonEntry{
+		Value:     e.Value,
+		Timeout:   timeoutSeconds(e.Timeout),
+		Permanent: e.Permanent,
+		Comment:   e.Comment,
+		Packets:   e.Packets,
+		Bytes:     e.Bytes,
+		SkbMark:   mark,
+		SkbPrio:   prio,
+		SkbQueue:  queue,
+		NoMatch:   e.NoMatch,
+		Hostname:  e.Hostname,
+	})
+}
+
+// UnmarshalJSON decodes an entry encoded by MarshalJSON.
+func (e *Entry) UnmarshalJSON(data []byte) error {
+	var j jsonEntry
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*e = Entry{
+		Value:     j.Value,
+		Timeout:   time.Duration(j.Timeout) * time.Second,
+		Permanent: j.Permanent,
+		Comment:   j.Comment,
+		Packets:   j.Packets,
+		Bytes:     j.Bytes,
+		NoMatch:   j.NoMatch,
+		Hostname:  j.Hostname,
+	}
+	if j.SkbMark != "" {
+		m, err := ParseSkbMark(j.SkbMark)
+		if err != nil {
+			return err
+		}
+		e.SkbMark = &m
+	}
+	if j.SkbPrio != "" {
+		p, err := ParseSkbPrio(j.SkbPrio)
+		if err != nil {
+			return err
+		}
+		e.SkbPrio = &p
+	}
+	if j.SkbQueue != "" {
+		q, err := ParseSkbQueue(j.SkbQueue)
+		if err != nil {
+			return err
+		}
+		e.SkbQueue = &q
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Reason classifies why an ipset command failed.
+type Reason int
+
+const (
+	ReasonUnknown Reason = iota
+	ReasonSetNotFound
+	ReasonSetExists
+	ReasonEntryExists
+	ReasonEntryNotFound
+	ReasonSetFull
+	ReasonSetInUse
+	ReasonTypeMismatch
+	ReasonPermission
+	ReasonSyntax
+	ReasonBusy
+)
+
+var reasonNames = [...]string{
+	ReasonUnknown:       "unknown",
+	ReasonSetNotFound:   "set not found",
+	ReasonSetExists:     "set exists",
+	ReasonEntryExists:   "entry exists",
+	ReasonEntryNotFound: "entry not found",
+	ReasonSetFull:       "set full",
+	ReasonSetInUse:      "set in use",
+	ReasonTypeMismatch:  "type mismatch",
+	ReasonPermission:    "permission denied",
+	ReasonSyntax:        "syntax error",
+	ReasonBusy:          "busy",
+}
+
+func (r Reason) String() string {
+	if r < 0 || int(r) >= len(reasonNames) {
+		return reasonNames[ReasonUnknown]
+	}
+	return reasonNames[r]
+}
+
+// reasonMessages maps fragments of ipset's messages to their reason.
+var reasonMessages = []struct {
+	fragment string
+	reason   Reason
+}{
+	{"The set with the given name does not exist", ReasonSetNotFound},
+	{"set with the same name already exists", ReasonSetExists},
+	{"it's already added", ReasonEntryExists},
+	{"it's not added", ReasonEntryNotFound},
+	{"is NOT in set", ReasonEntryNotFound},
+	{"Hash is full", ReasonSetFull},
+	{"in use by a kernel component", ReasonSetInUse},
+	{"type does not match", ReasonTypeMismatch},
+	{"Operation not permitted", ReasonPermission},
+	{"Syntax error", ReasonSyntax},
+	{"Unknown argument", ReasonSyntax},
+}
+
+// KernelError is a failed ipset command. Errors returned by the package for
+// such failures wrap it, so that errors.As retrieves it.
+type KernelError struct {
+	// Args is the command line run, e.g. ipset add foo 10.0.0.1.
+	Args []string
+	// ExitCode is the exit status of the ipset utility, or -1 for
+	// backends not running it.
+	ExitCode int
+	// Stderr is what the command reported, verbatim.
+	Stderr string
+	// Reason is the cause parsed from Stderr.
+	Reason Reason
+	Err    error
+}
+
+// Error returns the message of the underlying error; the messages of the
+// package add the command output themselves.
+func (e *KernelError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *KernelError) Unwrap() error {
+	return e.Err
+}
+
+// kernelError makes the failure of the command args a *KernelError, unless
+// the command could not be run at all.
+func kernelError(args []string, stderr []byte, err error) error {
+	var we *WrapperError
+	if errors.As(err, &we) || errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	ke, ok := err.(*KernelError)
+	if !ok {
+		ke = &KernelError{Args: append([]string{"ipset"}, args...), ExitCode: -1, Stderr: string(stderr), Err: err}
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			ke.ExitCode = ee.ExitCode()
+		}
+	}
+	ke.Reason = parseReason(ke.Stderr)
+	return ke
+}
+
+func parseReason(stderr string) Reason {
+	for _, m := range reasonMessages {
+		if strings.Contains(stderr, m.fragment) {
+			return m.reason
+		}
+	}
+	if transient([]byte(stderr)) {
+		return ReasonBusy
+	}
+	return ReasonUnknown
+}
+
+// WrapperError is returned by a Runner when the privilege wrapper itself
+// failed, e.g. because sudo wants a password, rather than ipset.
+type WrapperError struct {
+	Wrapper []string
+	Err     error
+	Stderr  string
+}
+
+func (e *WrapperError) Error() string {
+	msg := fmt.Sprintf("privilege wrapper %s failed: %v", strings.Join(e.Wrapper, " "), e.Err)
+	if e.Stderr != "" {
+		msg += " (" + e.Stderr + ")"
+	}
+	return msg
+}
+
+func (e *WrapperError) Unwrap() error {
+	return e.Err
+}
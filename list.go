@@ -0,0 +1,265 @@
+package go_ipset
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SetInfo describes a set as reported by ipset list: its header and, unless
+// only the header was requested, its members.
+type SetInfo struct {
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	Revision   int     `json:"revision"`
+	Family     string  `json:"family,omitempty"`
+	HashSize   int     `json:"hashsize,omitempty"`
+	MaxElem    int     `json:"maxelem,omitempty"`
+	Timeout    int     `json:"timeout,omitempty"`
+	Counters   bool    `json:"counters,omitempty"`
+	Comment    bool    `json:"comment,omitempty"`
+	SkbInfo    bool    `json:"skbinfo,omitempty"`
+	ForceAdd   bool    `json:"forceadd,omitempty"`
+	MemSize    int     `json:"memsize"`
+	References int     `json:"references"`
+	NumEntries int     `json:"numentries"`
+	Members    []Entry `json:"members,omitempty"`
+
+	// Generation and LastChange are those of the handle the set was listed
+	// through, see IPSet.Generation.
+	Generation uint64    `json:"generation,omitempty"`
+	LastChange time.Time `json:"last_change,omitzero"`
+
+	// timeoutExt is set by the netlink backend for sets with the timeout
+	// extension, which a default Timeout of 0 does not tell.
+	timeoutExt bool
+}
+
+type xmlIPSets struct {
+	Sets []xmlIPSet `xml:"ipset"`
+}
+
+type xmlIPSet struct {
+	Name     string    `xml:"name,attr"`
+	Type     string    `xml:"type"`
+	Revision int       `xml:"revision"`
+	Header   xmlHeader `xml:"header"`
+	Members  []xmlElem `xml:"members>member"`
+}
+
+type xmlHeader struct {
+	Family     string    `xml:"family"`
+	HashSize   int       `xml:"hashsize"`
+	MaxElem    int       `xml:"maxelem"`
+	Timeout    int       `xml:"timeout"`
+	Counters   *struct{} `xml:"counters"`
+	Comment    *struct{} `xml:"comment"`
+	SkbInfo    *struct{} `xml:"skbinfo"`
+	ForceAdd   *struct{} `xml:"forceadd"`
+	MemSize    int       `xml:"memsize"`
+	References int       `xml:"references"`
+	NumEntries int       `xml:"numentries"`
+}
+
+type xmlElem struct {
+	Elem     string    `xml:"elem"`
+	Timeout  int       `xml:"timeout"`
+	Packets  uint64    `xml:"packets"`
+	Bytes    uint64    `xml:"bytes"`
+	Comment  string    `xml:"comment"`
+	SkbMark  string    `xml:"skbmark"`
+	SkbPrio  string    `xml:"skbprio"`
+	SkbQueue string    `xml:"skbqueue"`
+	NoMatch  *struct{} `xml:"nomatch"`
+}
+
+// List returns the header and members of the set, parsed from ipset's JSON
+// output where supported and from its XML output otherwise.
+func (s *IPSet) List(opts ...ListOption) (*SetInfo, error) {
+	var o listOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var flags []string
+	if o.sorted {
+		flags = append(flags, "-sorted")
+	}
+	info, err := s.list(flags...)
+	if err != nil {
+		return nil, err
+	}
+	if o.sorted {
+		SortEntries(info.Members)
+	}
+	if o.resolve {
+		resolveEntries(info.Members)
+	}
+	return info, nil
+}
+
+// ListOption changes what List returns.
+type ListOption func(o *listOptions)
+
+type listOptions struct {
+	sorted  bool
+	resolve bool
+}
+
+// ListSorted orders the members by address (then by the full value), so
+// two listings of the same content compare equal line by line.
+func ListSorted() ListOption {
+	return func(o *listOptions) {
+		o.sorted = true
+	}
+}
+
+// ListResolve looks up the reverse DNS name of each member address, like
+// ipset -resolve, and stores it in Entry.Hostname next to the address.
+func ListResolve() ListOption {
+	return func(o *listOptions) {
+		o.resolve = true
+	}
+}
+
+// SortEntries sorts entries by their leading address or network, comparing
+// addresses numerically, and falls back to comparing the values as text.
+func SortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compareValues(entries[i].Value, entries[j].Value) < 0
+	})
+}
+
+func resolveEntries(entries []Entry) {
+	for i := range entries {
+		addr, err := netip.ParseAddr(strings.SplitN(entries[i].Value, ",", 2)[0])
+		if err != nil {
+			continue
+		}
+		names, err := net.LookupAddr(addr.String())
+		if err == nil && len(names) > 0 {
+			entries[i].Hostname = strings.TrimSuffix(names[0], ".")
+		}
+	}
+}
+
+func compareValues(a, b string) int {
+	pa, okA := parsePrefix(strings.SplitN(a, ",", 2)[0])
+	pb, okB := parsePrefix(strings.SplitN(b, ",", 2)[0])
+	switch {
+	case okA && okB:
+		if c := pa.Addr().Compare(pb.Addr()); c != 0 {
+			return c
+		}
+		if c := pa.Bits() - pb.Bits(); c != 0 {
+			return c
+		}
+	case okA:
+		return -1
+	case okB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Stats returns only the header of the set (entry count, memory usage,
+// references), without transferring its members.
+func (s *IPSet) Stats() (*SetInfo, error) {
+	return s.list("-t")
+}
+
+// ListAllInfo returns the header of every set on the host from a single
+// terse listing.
+func ListAllInfo() ([]SetInfo, error) {
+	return listSets("-t")
+}
+
+// Len returns the number of entries in the set, read from its header.
+func (s *IPSet) Len() (int, error) {
+	info, err := s.Stats()
+	if err != nil {
+		return 0, err
+	}
+	return info.NumEntries, nil
+}
+
+// MaxLen returns the maximum number of entries the set was created for.
+func (s *IPSet) MaxLen() int {
+	return s.MaxElem
+}
+
+func (s *IPSet) list(flags ...string) (*SetInfo, error) {
+	sets, err := listSets(append(flags, s.Name)...)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) != 1 {
+		return nil, fmt.Errorf("error listing set %s: got %d sets", s.Name, len(sets))
+	}
+	sets[0].Generation, sets[0].LastChange = s.Generation()
+	return &sets[0], nil
+}
+
+// listSets lists the sets selected by args in the most structured format
+// the installed ipset supports.
+func listSets(args ...string) ([]SetInfo, error) {
+	if jsonSupported() {
+		return listJSON(args...)
+	}
+	return listXML(args...)
+}
+
+// listXML runs ipset list -output xml with args and parses the result.
+func listXML(args ...string) ([]SetInfo, error) {
+	args = append([]string{"list", "-output", "xml"}, args...)
+	out, err := output(args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing ipset %s: %w (%s)", strings.Join(args[3:], " "), err, out)
+	}
+	return parseXML(out)
+}
+
+func parseXML(data []byte) ([]SetInfo, error) {
+	var doc xmlIPSets
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing ipset xml output: %v", err)
+	}
+	sets := make([]SetInfo, len(doc.Sets))
+	for i, x := range doc.Sets {
+		h := x.Header
+		sets[i] = SetInfo{
+			Name:       x.Name,
+			Type:       x.Type,
+			Revision:   x.Revision,
+			Family:     h.Family,
+			HashSize:   h.HashSize,
+			MaxElem:    h.MaxElem,
+			Timeout:    h.Timeout,
+			Counters:   h.Counters != nil,
+			Comment:    h.Comment != nil,
+			SkbInfo:    h.SkbInfo != nil,
+			ForceAdd:   h.ForceAdd != nil,
+			MemSize:    h.MemSize,
+			References: h.References,
+			NumEntries: h.NumEntries,
+		}
+		for _, m := range x.Members {
+			e := Entry{
+				Value:   strings.TrimSpace(m.Elem),
+				Timeout: time.Duration(m.Timeout) * time.Second,
+				Comment: strings.Trim(m.Comment, `"`),
+				Packets: m.Packets,
+				Bytes:   m.Bytes,
+				NoMatch: m.NoMatch != nil,
+			}
+			e.setSkb("skbmark", m.SkbMark)
+			e.setSkb("skbprio", m.SkbPrio)
+			e.setSkb("skbqueue", m.SkbQueue)
+			sets[i].Members = append(sets[i].Members, e)
+		}
+	}
+	return sets, nil
+}
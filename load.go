@@ -0,0 +1,70 @@
+package go_ipset
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// LoadPacing splits large loads of a set into batches, so that a
+// multi-million-entry import doesn't starve the kernel and the rest of
+// the system.
+type LoadPacing struct {
+	// ChunkSize is the number of entries fed to each ipset restore. Zero
+	// adds the entries of Refresh one by one and streams RefreshFromReader
+	// through a single restore.
+	ChunkSize int
+	// Pause is waited between chunks.
+	Pause time.Duration
+}
+
+// chunker feeds restore lines to ipset restore in batches of the size set
+// by the pacing of the set, holding no more than one batch in memory.
+type chunker struct {
+	s    *IPSet
+	buf  bytes.Buffer
+	n    int
+	sent bool
+}
+
+func (c *chunker) add(line string) error {
+	c.buf.WriteString(line)
+	c.buf.WriteByte('\n')
+	c.n++
+	if c.n < c.s.Pacing.ChunkSize {
+		return nil
+	}
+	return c.flush()
+}
+
+// canceled returns the error of a refresh stopped by err, a context error,
+// after loaded of total entries; total is negative when unknown.
+func (s *IPSet) canceled(loaded, total int, err error) error {
+	if total < 0 {
+		return fmt.Errorf("refresh of set %s canceled after %d entries: %w", s.Name, loaded, err)
+	}
+	return fmt.Errorf("refresh of set %s canceled after %d of %d entries: %w", s.Name, loaded, total, err)
+}
+
+// chunkError returns the error of a failed chunk loaded into the set name.
+func (s *IPSet) chunkError(name string, err error) error {
+	if full := s.fullError(name, err); full != nil {
+		return full
+	}
+	return err
+}
+
+// flush restores the lines buffered so far.
+func (c *chunker) flush() error {
+	if c.n == 0 {
+		return nil
+	}
+	if c.sent && c.s.Pacing.Pause > 0 {
+		time.Sleep(c.s.Pacing.Pause)
+	}
+	err := restore(c.s.DryRun, &c.buf, "-exist")
+	c.buf.Reset()
+	c.n = 0
+	c.sent = true
+	return err
+}
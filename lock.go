@@ -0,0 +1,81 @@
+package go_ipset
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Locker serializes the replacement of sets between processes, e.g. a node
+// agent and ad-hoc tooling refreshing the same set.
+type Locker interface {
+	// Lock blocks until the named set is locked for the caller and returns
+	// the function releasing it.
+	Lock(set string) (unlock func(), err error)
+}
+
+var (
+	lockerMu      sync.Mutex
+	defaultLocker Locker
+)
+
+// SetLocker makes Refresh and Swap of every handle without its own Locker
+// hold l while replacing sets. A nil l only serializes within the process.
+func SetLocker(l Locker) {
+	lockerMu.Lock()
+	defaultLocker = l
+	lockerMu.Unlock()
+}
+
+func activeLocker(l Locker) Locker {
+	if l != nil {
+		return l
+	}
+	lockerMu.Lock()
+	defer lockerMu.Unlock()
+	return defaultLocker
+}
+
+// lockSets locks names in a fixed order with l, if any.
+func lockSets(l Locker, names ...string) (func(), error) {
+	if l = activeLocker(l); l == nil {
+		return func() {}, nil
+	}
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	var unlocks []func()
+	unlockAll := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, name := range names {
+		unlock, err := l.Lock(name)
+		if err != nil {
+			unlockAll()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return unlockAll, nil
+}
+
+// FileLocker locks sets with flock(2) on a file per set in Dir, which
+// defaults to /run/go-ipset, so every process using the same directory
+// takes turns.
+type FileLocker struct {
+	Dir string
+}
+
+func (l FileLocker) Lock(set string) (func(), error) {
+	dir := l.Dir
+	if dir == "" {
+		dir = "/run/go-ipset"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return flockFile(filepath.Join(dir, strings.ReplaceAll(set, "/", "_")+".lock"))
+}
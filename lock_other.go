@@ -0,0 +1,7 @@
+//go:build !linux
+
+package go_ipset
+
+func flockFile(path string) (func(), error) {
+	return nil, ErrUnsupportedPlatform
+}
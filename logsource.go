@@ -0,0 +1,161 @@
+package go_ipset
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogSource turns log lines into bans: addresses extracted from matching
+// lines are banned once they reach Hits hits within Window.
+type LogSource struct {
+	Bans *BanManager
+	// Match selects the lines to consider; nil considers every line.
+	Match func(line string) bool
+	// Extract returns the offending address of a line.
+	Extract func(line string) (ip string, ok bool)
+
+	Hits   int
+	Window time.Duration
+	BanTTL time.Duration
+	Reason string
+	// OnError receives ban errors; it may be nil.
+	OnError func(error)
+
+	once sync.Once
+	rate *slidingWindow
+}
+
+// Feed processes a single log line.
+func (l *LogSource) Feed(line string) {
+	l.once.Do(func() {
+		l.rate = newSlidingWindow(l.Hits, l.Window)
+	})
+	if l.Match != nil && !l.Match(line) {
+		return
+	}
+	ip, ok := l.Extract(line)
+	if !ok || !l.rate.observe(ip, time.Now()) {
+		return
+	}
+	if err := l.Bans.Ban(ip, l.BanTTL, l.Reason); err != nil && l.OnError != nil {
+		l.OnError(err)
+	}
+}
+
+// ReadFrom feeds every line of r until EOF or ctx is done.
+func (l *LogSource) ReadFrom(ctx context.Context, r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.Feed(sc.Text())
+	}
+	return sc.Err()
+}
+
+// Tail follows the file at path like tail -F, feeding lines appended after
+// the call, and reopens the file when it is rotated or truncated. It polls
+// for new data every poll until ctx is done.
+func (l *LogSource) Tail(ctx context.Context, path string, poll time.Duration) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	rd := bufio.NewReader(f)
+	var partial string
+	for {
+		line, err := rd.ReadString('\n')
+		offset += int64(len(line))
+		if err == nil {
+			l.Feed(strings.TrimRight(partial+line, "\r\n"))
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		partial += line
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+		cur, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		st, err := os.Stat(path)
+		if err != nil {
+			// rotated away and not yet recreated
+			continue
+		}
+		if !os.SameFile(cur, st) || st.Size() < offset {
+			nf, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			f.Close()
+			f, offset, partial = nf, 0, ""
+			rd.Reset(f)
+		}
+	}
+}
+
+// slidingWindow counts events per key and reports when a key reaches limit
+// events within window.
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	events map[string][]time.Time
+	pruned time.Time
+}
+
+func newSlidingWindow(limit int, window time.Duration) *slidingWindow {
+	return &slidingWindow{limit: limit, window: window, events: make(map[string][]time.Time)}
+}
+
+// observe records an event for key at now and reports whether the limit was
+// reached, in which case the count for key starts over.
+func (w *slidingWindow) observe(key string, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if now.Sub(w.pruned) > w.window {
+		w.prune(now)
+	}
+	times := w.events[key]
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > w.window {
+		i++
+	}
+	times = append(times[i:], now)
+	if len(times) >= w.limit {
+		delete(w.events, key)
+		return true
+	}
+	w.events[key] = times
+	return false
+}
+
+// prune forgets keys without events in the current window. w.mu must be
+// held.
+func (w *slidingWindow) prune(now time.Time) {
+	for key, times := range w.events {
+		if now.Sub(times[len(times)-1]) > w.window {
+			delete(w.events, key)
+		}
+	}
+	w.pruned = now
+}
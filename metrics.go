@@ -0,0 +1,191 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the operation latency histograms.
+var LatencyBuckets = []time.Duration{
+	500 * time.Microsecond, time.Millisecond, 2500 * time.Microsecond,
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+}
+
+// OpStats are the metrics of one ipset command, e.g. "add" or "restore".
+type OpStats struct {
+	Op        string
+	Successes uint64
+	// Errors counts failures by class: the Reason of kernel errors,
+	// "wrapper" for failures of the ipset wrapper, "unsupported" or
+	// "other".
+	Errors map[string]uint64
+	// Buckets counts the operations per latency bucket, cumulatively: the
+	// i-th count is of operations done within LatencyBuckets[i].
+	Buckets []uint64
+	Sum     time.Duration
+}
+
+// Count returns the number of operations.
+func (o OpStats) Count() uint64 {
+	n := o.Successes
+	for _, c := range o.Errors {
+		n += c
+	}
+	return n
+}
+
+// OpError is a failed ipset command, as kept for diagnostics.
+type OpError struct {
+	Time  time.Time `json:"time"`
+	Op    string    `json:"op"`
+	Error string    `json:"error"`
+}
+
+// maxRecentErrors bounds the failures kept for RecentErrors.
+const maxRecentErrors = 32
+
+var (
+	metricsMu    sync.Mutex
+	metrics      = make(map[string]*OpStats)
+	recentErrors []OpError
+)
+
+// record adds an operation run with args to the metrics.
+func record(args []string, d time.Duration, err error) {
+	op := opName(args)
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	m, ok := metrics[op]
+	if !ok {
+		m = &OpStats{Op: op, Errors: make(map[string]uint64), Buckets: make([]uint64, len(LatencyBuckets))}
+		metrics[op] = m
+	}
+	if err == nil {
+		m.Successes++
+	} else {
+		m.Errors[errorClass(err)]++
+		if len(recentErrors) == maxRecentErrors {
+			recentErrors = recentErrors[1:]
+		}
+		recentErrors = append(recentErrors, OpError{Time: time.Now(), Op: op, Error: err.Error()})
+	}
+	for i, b := range LatencyBuckets {
+		if d <= b {
+			m.Buckets[i]++
+		}
+	}
+	m.Sum += d
+}
+
+// opName returns the command of an ipset argument list.
+func opName(args []string) string {
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			return a
+		}
+	}
+	return "none"
+}
+
+func errorClass(err error) string {
+	var ke *KernelError
+	var we *WrapperError
+	switch {
+	case errors.As(err, &ke):
+		return ke.Reason.String()
+	case errors.As(err, &we):
+		return "wrapper"
+	case errors.Is(err, ErrUnsupported):
+		return "unsupported"
+	}
+	return "other"
+}
+
+// Stats returns a snapshot of the metrics of the ipset commands run by the
+// package, ordered by command.
+func Stats() []OpStats {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	stats := make([]OpStats, 0, len(metrics))
+	for _, m := range metrics {
+		o := *m
+		o.Errors = make(map[string]uint64, len(m.Errors))
+		for class, n := range m.Errors {
+			o.Errors[class] = n
+		}
+		o.Buckets = slices.Clone(m.Buckets)
+		stats = append(stats, o)
+	}
+	slices.SortFunc(stats, func(a, b OpStats) int { return strings.Compare(a.Op, b.Op) })
+	return stats
+}
+
+// RecentErrors returns the last failed commands, oldest first.
+func RecentErrors() []OpError {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	return slices.Clone(recentErrors)
+}
+
+// ResetStats clears the metrics and the recent errors.
+func ResetStats() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics = make(map[string]*OpStats)
+	recentErrors = nil
+}
+
+// WritePrometheus writes the metrics to w in the Prometheus text format:
+// the histogram ipset_operation_duration_seconds and the counters
+// ipset_operations_total and ipset_operation_errors_total, by op and, for
+// errors, by class.
+func WritePrometheus(w io.Writer) error {
+	var b strings.Builder
+	stats := Stats()
+	b.WriteString("# HELP ipset_operation_duration_seconds Latency of ipset commands.\n")
+	b.WriteString("# TYPE ipset_operation_duration_seconds histogram\n")
+	for _, o := range stats {
+		for i, le := range LatencyBuckets {
+			fmt.Fprintf(&b, "ipset_operation_duration_seconds_bucket{op=%q,le=\"%g\"} %d\n", o.Op, le.Seconds(), o.Buckets[i])
+		}
+		fmt.Fprintf(&b, "ipset_operation_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", o.Op, o.Count())
+		fmt.Fprintf(&b, "ipset_operation_duration_seconds_sum{op=%q} %g\n", o.Op, o.Sum.Seconds())
+		fmt.Fprintf(&b, "ipset_operation_duration_seconds_count{op=%q} %d\n", o.Op, o.Count())
+	}
+	b.WriteString("# HELP ipset_operations_total Successful ipset commands.\n")
+	b.WriteString("# TYPE ipset_operations_total counter\n")
+	for _, o := range stats {
+		fmt.Fprintf(&b, "ipset_operations_total{op=%q} %d\n", o.Op, o.Successes)
+	}
+	b.WriteString("# HELP ipset_operation_errors_total Failed ipset commands.\n")
+	b.WriteString("# TYPE ipset_operation_errors_total counter\n")
+	for _, o := range stats {
+		classes := make([]string, 0, len(o.Errors))
+		for class := range o.Errors {
+			classes = append(classes, class)
+		}
+		slices.Sort(classes)
+		for _, class := range classes {
+			fmt.Fprintf(&b, "ipset_operation_errors_total{op=%q,class=%q} %d\n", o.Op, class, o.Errors[class])
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// MetricsHandler returns an HTTP handler serving WritePrometheus, for a
+// Prometheus scrape endpoint.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		WritePrometheus(w)
+	})
+}
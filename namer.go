@@ -0,0 +1,109 @@
+package go_ipset
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxNameLen is the longest set name the kernel accepts.
+const MaxNameLen = 31
+
+// ValidName checks name against the kernel's naming limits.
+func ValidName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty set name")
+	}
+	if len(name) > MaxNameLen {
+		return fmt.Errorf("set name %s longer than %d characters", name, MaxNameLen)
+	}
+	if strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("set name %q contains whitespace", name)
+	}
+	return nil
+}
+
+// NameParts are the components of a name made by a Namer.
+type NameParts struct {
+	App     string
+	Purpose string
+	Family  string
+	Version int
+}
+
+// Namer builds set names of the form app-purpose-4-v1 (6 for inet6), so
+// the sets of several applications on one host never collide and each can
+// recognize its own.
+type Namer struct {
+	App string
+	// Sep separates the components; defaults to "-".
+	Sep string
+}
+
+func (n Namer) sep() string {
+	if n.Sep == "" {
+		return "-"
+	}
+	return n.Sep
+}
+
+// Name returns the set name for the given components.
+func (n Namer) Name(purpose, family string, version int) (string, error) {
+	sep := n.sep()
+	for _, c := range []string{n.App, purpose} {
+		if c == "" || strings.Contains(c, sep) {
+			return "", fmt.Errorf("invalid name component %q", c)
+		}
+	}
+	var fam string
+	switch family {
+	case FamilyInet, "":
+		fam = "4"
+	case FamilyInet6:
+		fam = "6"
+	default:
+		return "", fmt.Errorf("unknown family: %s", family)
+	}
+	if version < 0 {
+		return "", fmt.Errorf("negative version %d", version)
+	}
+	name := strings.Join([]string{n.App, purpose, fam, "v" + strconv.Itoa(version)}, sep)
+	if err := ValidName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Parse splits a name made by this Namer back into its components.
+func (n Namer) Parse(name string) (NameParts, error) {
+	parts := strings.Split(name, n.sep())
+	if len(parts) != 4 || parts[0] != n.App || !strings.HasPrefix(parts[3], "v") {
+		return NameParts{}, fmt.Errorf("set name %s not made by namer %s", name, n.App)
+	}
+	version, err := strconv.Atoi(parts[3][1:])
+	if err != nil || version < 0 {
+		return NameParts{}, fmt.Errorf("bad version in set name %s", name)
+	}
+	var family string
+	switch parts[2] {
+	case "4":
+		family = FamilyInet
+	case "6":
+		family = FamilyInet6
+	default:
+		return NameParts{}, fmt.Errorf("bad family in set name %s", name)
+	}
+	return NameParts{App: parts[0], Purpose: parts[1], Family: family, Version: version}, nil
+}
+
+// Owns reports whether name was made by this Namer.
+func (n Namer) Owns(name string) bool {
+	_, err := n.Parse(name)
+	return err == nil
+}
+
+// Prefix returns the name prefix shared by all sets of the application,
+// for use with DestroyAllWithPrefix.
+func (n Namer) Prefix() string {
+	return n.App + n.sep()
+}
@@ -0,0 +1,967 @@
+package go_ipset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Constants of the ipset netlink protocol, from linux/netfilter/ipset/ip_set.h.
+const (
+	nfnlSubsysIPSet = 6
+	ipsetProtocol   = 6
+
+	ipsetCmdProtocol = 1
+	ipsetCmdCreate   = 2
+	ipsetCmdDestroy  = 3
+	ipsetCmdFlush    = 4
+	ipsetCmdRename   = 5
+	ipsetCmdSwap     = 6
+	ipsetCmdList     = 7
+	ipsetCmdAdd      = 9
+	ipsetCmdDel      = 10
+	ipsetCmdTest     = 11
+	ipsetCmdType     = 13
+
+	attrProtocol = 1
+	attrSetname  = 2
+	attrTypename = 3
+	attrSetname2 = 3
+	attrRevision = 4
+	attrFamily   = 5
+	attrFlags    = 6
+	attrData     = 7
+	attrADT      = 8
+
+	attrIP         = 1
+	attrCIDR       = 3
+	attrPort       = 4
+	attrTimeout    = 6
+	attrProto      = 7
+	attrCadtFlags  = 8
+	attrMark       = 10
+	attrHashSize   = 18
+	attrMaxElem    = 19
+	attrNetmask    = 20
+	attrBucketSize = 21
+	attrElements   = 24
+	attrReferences = 25
+	attrMemSize    = 26
+	attrEther      = 17
+	attrName       = 18
+	attrIP2        = 20
+	attrCIDR2      = 21
+	attrIface      = 23
+	attrBytes      = 24
+	attrPackets    = 25
+	attrComment    = 26
+
+	attrIPAddrIPv4 = 1
+	attrIPAddrIPv6 = 2
+
+	cadtPhysdev      = 1 << 1
+	cadtNoMatch      = 1 << 2
+	cadtWithCounters = 1 << 3
+	cadtWithComment  = 1 << 4
+	cadtWithForceAdd = 1 << 5
+	cadtWithSkbInfo  = 1 << 6
+
+	listSetname = 1 << 1
+	listHeader  = 1 << 2
+
+	nfprotoIPv4 = 2
+	nfprotoIPv6 = 10
+
+	nlaNested       = 1 << 15
+	nlaNetByteorder = 1 << 14
+
+	nlmFAck  = 0x4
+	nlmFExcl = 0x200
+	nlmFDump = 0x300
+)
+
+// Error codes of the ipset subsystem, in addition to plain errnos.
+const (
+	ipsetErrProtocol      nlErrno = 4097
+	ipsetErrFindType      nlErrno = 4098
+	ipsetErrMaxSets       nlErrno = 4099
+	ipsetErrBusy          nlErrno = 4100
+	ipsetErrExistSetname2 nlErrno = 4101
+	ipsetErrTypeMismatch  nlErrno = 4102
+	ipsetErrExist         nlErrno = 4103
+	ipsetErrInvalidCIDR   nlErrno = 4104
+	ipsetErrInvalidMask   nlErrno = 4105
+	ipsetErrInvalidFamily nlErrno = 4106
+	ipsetErrTimeout       nlErrno = 4107
+	ipsetErrReferenced    nlErrno = 4108
+	ipsetErrIPv4          nlErrno = 4109
+	ipsetErrIPv6          nlErrno = 4110
+	ipsetErrCounter       nlErrno = 4111
+	ipsetErrComment       nlErrno = 4112
+	ipsetErrHashFull      nlErrno = 4352
+	ipsetErrHashElem      nlErrno = 4353
+)
+
+// nlErrno is an error code reported by the kernel: an errno or one of
+// ipset's own codes.
+type nlErrno int
+
+func (e nlErrno) Error() string {
+	if e >= 4096 {
+		return fmt.Sprintf("ipset error %d", int(e))
+	}
+	return syscall.Errno(e).Error()
+}
+
+// nlReasons words kernel errors like the ipset utility does.
+var nlReasons = map[nlErrno]string{
+	1:                     "Kernel error received: Operation not permitted (CAP_NET_ADMIN required)",
+	2:                     "The set with the given name does not exist",
+	ipsetErrProtocol:      "Kernel error received: ipset protocol error",
+	ipsetErrFindType:      "Kernel error received: set type not supported",
+	ipsetErrMaxSets:       "Kernel error received: maximal number of sets reached, cannot create more.",
+	ipsetErrBusy:          "Set cannot be destroyed: it is in use by a kernel component",
+	ipsetErrExistSetname2: "Set cannot be renamed: a set with the new name already exists",
+	ipsetErrTypeMismatch:  "The sets cannot be swapped: their type does not match",
+	ipsetErrInvalidCIDR:   "The value of the CIDR parameter of the IP address is invalid",
+	ipsetErrInvalidMask:   "The value of the netmask parameter is invalid",
+	ipsetErrInvalidFamily: "Protocol family not supported by the set type",
+	ipsetErrTimeout:       "Timeout cannot be used: set was created without timeout support",
+	ipsetErrReferenced:    "Set cannot be destroyed: it is in use by a kernel component",
+	ipsetErrIPv4:          "An IPv4 address is expected, but not received",
+	ipsetErrIPv6:          "An IPv6 address is expected, but not received",
+	ipsetErrCounter:       "Packet/byte counters cannot be used: set was created without counter support",
+	ipsetErrComment:       "Comment cannot be used: set was created without comment support",
+	ipsetErrHashFull:      "Hash is full, cannot add more elements",
+	ipsetErrHashElem:      "Null-valued element, cannot be stored in a hash type of set",
+}
+
+// nlError is a failed command of the netlink backend: the reason, worded
+// like the ipset utility does, and the underlying cause.
+type nlError struct {
+	reason string
+	err    error
+}
+
+func (e *nlError) Error() string {
+	return e.reason
+}
+
+var errNetlinkSyntax = errors.New("ipset syntax error")
+
+func syntaxErr(format string, a ...any) error {
+	return &nlError{fmt.Sprintf(format, a...), errNetlinkSyntax}
+}
+
+func unsupported(format string, a ...any) error {
+	what := fmt.Sprintf(format, a...)
+	return &nlError{what + " is not supported by the netlink backend", fmt.Errorf("%w: %s", ErrUnsupported, what)}
+}
+
+func kernelErr(cmd uint8, err error) error {
+	var code nlErrno
+	if !errors.As(err, &code) {
+		return &nlError{"Kernel error received: " + err.Error(), err}
+	}
+	reason, ok := nlReasons[code]
+	switch {
+	case code == ipsetErrExist && cmd == ipsetCmdAdd:
+		reason = "Element cannot be added to the set: it's already added"
+	case code == ipsetErrExist && cmd == ipsetCmdDel:
+		reason = "Element cannot be deleted from the set: it's not added"
+	case code == ipsetErrExistSetname2 && cmd == ipsetCmdSwap:
+		reason = "Sets cannot be swapped: the second set does not exist"
+	case (code == 17 || code == ipsetErrExist || code == ipsetErrExistSetname2) && cmd == ipsetCmdCreate:
+		reason = "Set cannot be created: set with the same name already exists"
+	case !ok:
+		reason = "Kernel error received: " + code.Error()
+	}
+	return &nlError{reason, err}
+}
+
+// nlAttrs is a sequence of encoded netlink attributes.
+type nlAttrs []byte
+
+func (a *nlAttrs) add(typ uint16, data []byte) {
+	*a = binary.NativeEndian.AppendUint16(*a, uint16(4+len(data)))
+	*a = binary.NativeEndian.AppendUint16(*a, typ)
+	*a = append(*a, data...)
+	for len(*a)%4 != 0 {
+		*a = append(*a, 0)
+	}
+}
+
+func (a *nlAttrs) u8(typ uint16, v uint8) {
+	a.add(typ, []byte{v})
+}
+
+func (a *nlAttrs) u16(typ uint16, v uint16) {
+	a.add(typ|nlaNetByteorder, binary.BigEndian.AppendUint16(nil, v))
+}
+
+func (a *nlAttrs) u32(typ uint16, v uint32) {
+	a.add(typ|nlaNetByteorder, binary.BigEndian.AppendUint32(nil, v))
+}
+
+func (a *nlAttrs) u64(typ uint16, v uint64) {
+	a.add(typ|nlaNetByteorder, binary.BigEndian.AppendUint64(nil, v))
+}
+
+func (a *nlAttrs) str(typ uint16, s string) {
+	a.add(typ, append([]byte(s), 0))
+}
+
+func (a *nlAttrs) nest(typ uint16, inner nlAttrs) {
+	a.add(typ|nlaNested, inner)
+}
+
+func (a *nlAttrs) addr(typ uint16, ip netip.Addr) {
+	var inner nlAttrs
+	if ip.Is4() {
+		inner.add(attrIPAddrIPv4|nlaNetByteorder, ip.AsSlice())
+	} else {
+		inner.add(attrIPAddrIPv6|nlaNetByteorder, ip.AsSlice())
+	}
+	a.nest(typ, inner)
+}
+
+// protoAttrs starts the attributes of a request with the protocol version.
+func protoAttrs() nlAttrs {
+	var a nlAttrs
+	a.u8(attrProtocol, ipsetProtocol)
+	return a
+}
+
+// nlAttr is a decoded netlink attribute, its type stripped of flags.
+type nlAttr struct {
+	typ  uint16
+	data []byte
+}
+
+func parseAttrs(b []byte) []nlAttr {
+	var attrs []nlAttr
+	for len(b) >= 4 {
+		l := int(binary.NativeEndian.Uint16(b))
+		if l < 4 || l > len(b) {
+			break
+		}
+		typ := binary.NativeEndian.Uint16(b[2:]) &^ (nlaNested | nlaNetByteorder)
+		attrs = append(attrs, nlAttr{typ, b[4:l]})
+		l = (l + 3) &^ 3
+		if l >= len(b) {
+			break
+		}
+		b = b[l:]
+	}
+	return attrs
+}
+
+func attrMap(b []byte) map[uint16]nlAttr {
+	m := make(map[uint16]nlAttr)
+	for _, a := range parseAttrs(b) {
+		m[a.typ] = a
+	}
+	return m
+}
+
+func (a nlAttr) u8() uint8 {
+	if len(a.data) < 1 {
+		return 0
+	}
+	return a.data[0]
+}
+
+func (a nlAttr) u16() uint16 {
+	if len(a.data) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(a.data)
+}
+
+func (a nlAttr) u32() uint32 {
+	if len(a.data) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(a.data)
+}
+
+func (a nlAttr) u64() uint64 {
+	if len(a.data) < 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(a.data)
+}
+
+func (a nlAttr) str() string {
+	s, _, _ := bytes.Cut(a.data, []byte{0})
+	return string(s)
+}
+
+func (a nlAttr) addr() netip.Addr {
+	for _, in := range parseAttrs(a.data) {
+		if ip, ok := netip.AddrFromSlice(in.data); ok {
+			return ip
+		}
+	}
+	return netip.Addr{}
+}
+
+var protoNumbers = map[string]uint8{"tcp": 6, "udp": 17, "sctp": 132, "udplite": 136}
+
+func protoName(n uint8) string {
+	for name, v := range protoNumbers {
+		if v == n {
+			return name
+		}
+	}
+	return strconv.Itoa(int(n))
+}
+
+func familyName(f uint8) string {
+	switch f {
+	case nfprotoIPv4:
+		return FamilyInet
+	case nfprotoIPv6:
+		return FamilyInet6
+	}
+	return ""
+}
+
+// typeDims returns the dimensions of a set type, e.g. ip and port for
+// hash:ip,port.
+func typeDims(typ string) []string {
+	_, dims, _ := strings.Cut(typ, ":")
+	return strings.Split(dims, ",")
+}
+
+// netlinkBackend talks to the ipset subsystem of the kernel over netlink.
+type netlinkBackend struct{}
+
+// NetlinkBackend returns a backend talking netlink to the kernel directly,
+// for hosts and containers without the ipset utility; the process needs
+// CAP_NET_ADMIN. It carries out the commands this package issues. Members
+// made of ip, net, port, mac, iface, mark and set dimensions are supported,
+// address and port ranges, protocol and port names and skb options are not
+// and fail with ErrUnsupported, as do list outputs other than xml and save.
+func NetlinkBackend() (Backend, error) {
+	if _, err := nlRequest(ipsetCmdProtocol, nlmFAck, protoAttrs()); err != nil {
+		return nil, fmt.Errorf("error opening ipset netlink: %v", kernelErr(ipsetCmdProtocol, err))
+	}
+	return netlinkBackend{}, nil
+}
+
+// nlCommand holds the global options of a command.
+type nlCommand struct {
+	exist  bool
+	terse  bool
+	names  bool
+	output string
+}
+
+// parse strips the global options from args.
+func (c *nlCommand) parse(args []string) []string {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-exist", "-!":
+			c.exist = true
+		case "-t", "-terse":
+			c.terse = true
+		case "-n", "-name":
+			c.names = true
+		case "-o", "-output":
+			if i+1 < len(args) {
+				i++
+				c.output = args[i]
+			}
+		case "-q", "-quiet", "-s", "-sorted":
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest
+}
+
+func (b netlinkBackend) Run(stdin io.Reader, args ...string) ([]byte, []byte, error) {
+	return runCommand(stdin, args, b.command)
+}
+
+// runCommand carries out the ipset command line args with command, or the
+// restore input read from stdin, and reports failures like the ipset
+// utility does.
+func runCommand(stdin io.Reader, args []string, command func(nlCommand, []string) ([]byte, error)) ([]byte, []byte, error) {
+	var c nlCommand
+	args = c.parse(args)
+	var (
+		out []byte
+		err error
+	)
+	if len(args) == 1 && (args[0] == "restore" || args[0] == "-R") {
+		err = restoreCommands(c, stdin, command)
+	} else {
+		out, err = command(c, args)
+	}
+	var e *nlError
+	if errors.As(err, &e) {
+		return nil, []byte("ipset: " + e.reason + "\n"), e.err
+	}
+	return out, nil, err
+}
+
+func (b netlinkBackend) command(c nlCommand, args []string) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, syntaxErr("No command specified")
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "create", "-N", "n":
+		return nil, b.create(c, args)
+	case "add", "-A", "a":
+		return nil, b.adt(ipsetCmdAdd, c, args)
+	case "del", "-D", "d":
+		return nil, b.adt(ipsetCmdDel, c, args)
+	case "test", "-T", "t":
+		if err := b.adt(ipsetCmdTest, c, args); err != nil {
+			return nil, err
+		}
+		return []byte(fmt.Sprintf("%s is in set %s.\n", args[1], args[0])), nil
+	case "destroy", "-X", "x":
+		return nil, b.names(ipsetCmdDestroy, args, 0, 1)
+	case "flush", "-F", "f":
+		return nil, b.names(ipsetCmdFlush, args, 0, 1)
+	case "rename", "-E", "e":
+		return nil, b.names(ipsetCmdRename, args, 2, 2)
+	case "swap", "-W", "w":
+		return nil, b.names(ipsetCmdSwap, args, 2, 2)
+	case "list", "-L", "l":
+		return b.list(c, args)
+	case "save", "-S", "s":
+		c.output = "save"
+		return b.list(c, args)
+	}
+	return nil, unsupported("command %s", cmd)
+}
+
+// restoreCommands runs the commands read from r, one per line.
+func restoreCommands(c nlCommand, r io.Reader, command func(nlCommand, []string) ([]byte, error)) error {
+	if r == nil {
+		return syntaxErr("restore requires input")
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line == "COMMIT" {
+			continue
+		}
+		lc := c
+		if _, err := command(lc, lc.parse(splitFields(line))); err != nil {
+			var e *nlError
+			if errors.As(err, &e) {
+				return &nlError{fmt.Sprintf("Error in line %d: %s", n, e.reason), e.err}
+			}
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return &nlError{"error reading restore input: " + err.Error(), err}
+	}
+	return nil
+}
+
+func (b netlinkBackend) create(c nlCommand, args []string) error {
+	if len(args) < 2 {
+		return syntaxErr("create requires a set name and type")
+	}
+	family := uint8(nfprotoIPv4)
+	var (
+		data nlAttrs
+		cadt uint32
+	)
+	for i := 2; i < len(args); i++ {
+		opt := args[i]
+		switch opt {
+		case "counters":
+			cadt |= cadtWithCounters
+		case "comment":
+			cadt |= cadtWithComment
+		case "forceadd":
+			cadt |= cadtWithForceAdd
+		case "skbinfo":
+			cadt |= cadtWithSkbInfo
+		case "family", "hashsize", "maxelem", "timeout", "netmask", "bucketsize":
+			if i+1 >= len(args) {
+				return syntaxErr("Missing value of create option %s", opt)
+			}
+			i++
+			if opt == "family" {
+				switch args[i] {
+				case FamilyInet:
+					family = nfprotoIPv4
+				case FamilyInet6:
+					family = nfprotoIPv6
+				default:
+					return syntaxErr("Unknown family %s", args[i])
+				}
+				continue
+			}
+			n, err := strconv.ParseUint(args[i], 10, 32)
+			if err != nil {
+				return syntaxErr("Invalid value %s of create option %s", args[i], opt)
+			}
+			switch opt {
+			case "hashsize":
+				data.u32(attrHashSize, uint32(n))
+			case "maxelem":
+				data.u32(attrMaxElem, uint32(n))
+			case "timeout":
+				data.u32(attrTimeout, uint32(n))
+			case "netmask":
+				data.u8(attrNetmask, uint8(n))
+			case "bucketsize":
+				data.u8(attrBucketSize, uint8(n))
+			}
+		default:
+			return unsupported("create option %s", opt)
+		}
+	}
+	if cadt != 0 {
+		data.u32(attrCadtFlags, cadt)
+	}
+	rev, err := nlRevision(args[1], family)
+	if err != nil {
+		return err
+	}
+	a := protoAttrs()
+	a.str(attrSetname, args[0])
+	a.str(attrTypename, args[1])
+	a.u8(attrRevision, rev)
+	a.u8(attrFamily, family)
+	a.nest(attrData, data)
+	flags := uint16(nlmFAck)
+	if !c.exist {
+		flags |= nlmFExcl
+	}
+	if _, err := nlRequest(ipsetCmdCreate, flags, a); err != nil {
+		return kernelErr(ipsetCmdCreate, err)
+	}
+	return nil
+}
+
+// nlRevision returns the newest revision of the set type the kernel
+// supports.
+func nlRevision(typ string, family uint8) (uint8, error) {
+	a := protoAttrs()
+	a.str(attrTypename, typ)
+	a.u8(attrFamily, family)
+	replies, err := nlRequest(ipsetCmdType, nlmFAck, a)
+	if err != nil {
+		return 0, kernelErr(ipsetCmdType, err)
+	}
+	for _, r := range replies {
+		if rev, ok := attrMap(r)[attrRevision]; ok {
+			return rev.u8(), nil
+		}
+	}
+	return 0, kernelErr(ipsetCmdType, ipsetErrProtocol)
+}
+
+// adt runs an add, del or test command.
+func (b netlinkBackend) adt(cmd uint8, c nlCommand, args []string) error {
+	if len(args) < 2 {
+		return syntaxErr("A set name and an entry are required")
+	}
+	name, value := args[0], args[1]
+	data, cadt, err := b.element(name, value)
+	if err != nil {
+		return err
+	}
+	for i := 2; i < len(args); i++ {
+		opt := args[i]
+		if opt == "nomatch" {
+			cadt |= cadtNoMatch
+			continue
+		}
+		if i+1 >= len(args) {
+			return syntaxErr("Missing value of entry option %s", opt)
+		}
+		i++
+		if opt == "comment" {
+			data.str(attrComment, args[i])
+			continue
+		}
+		n, err := strconv.ParseUint(args[i], 10, 64)
+		if err != nil {
+			return unsupported("entry option %s %s", opt, args[i])
+		}
+		switch opt {
+		case "timeout":
+			data.u32(attrTimeout, uint32(n))
+		case "packets":
+			data.u64(attrPackets, n)
+		case "bytes":
+			data.u64(attrBytes, n)
+		default:
+			return unsupported("entry option %s", opt)
+		}
+	}
+	if cadt != 0 {
+		data.u32(attrCadtFlags, cadt)
+	}
+	a := protoAttrs()
+	a.str(attrSetname, name)
+	a.nest(attrData, data)
+	flags := uint16(nlmFAck)
+	if !c.exist {
+		flags |= nlmFExcl
+	}
+	if _, err := nlRequest(cmd, flags, a); err != nil {
+		if cmd == ipsetCmdTest && errors.Is(err, ipsetErrExist) {
+			return &nlError{fmt.Sprintf("%s is NOT in set %s.", value, name), err}
+		}
+		return kernelErr(cmd, err)
+	}
+	return nil
+}
+
+// element encodes the member value of an add, del or test command. Plain
+// addresses and networks are encoded as they are, other values are split
+// into the dimensions of the set's type, which is looked up first.
+func (b netlinkBackend) element(set, value string) (nlAttrs, uint32, error) {
+	dims := []string{"net"}
+	if _, ok := parsePrefix(value); !ok {
+		sets, err := b.dump(set, listHeader)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(sets) == 0 {
+			return nil, 0, kernelErr(ipsetCmdList, nlErrno(syscall.ENOENT))
+		}
+		dims = typeDims(sets[0].Type)
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) != len(dims) {
+		return nil, 0, syntaxErr("Entry %s does not match the type of set %s", value, set)
+	}
+	var (
+		data nlAttrs
+		cadt uint32
+		ips  int
+	)
+	for i, d := range dims {
+		v := parts[i]
+		switch d {
+		case "ip", "net":
+			p, ok := parsePrefix(v)
+			if !ok {
+				if strings.Contains(v, "-") {
+					return nil, 0, unsupported("address range %s", v)
+				}
+				return nil, 0, syntaxErr("Syntax error: cannot parse %s: resolving to IP address failed", v)
+			}
+			ipAttr, cidrAttr := uint16(attrIP), uint16(attrCIDR)
+			if ips > 0 {
+				ipAttr, cidrAttr = attrIP2, attrCIDR2
+			}
+			ips++
+			data.addr(ipAttr, p.Addr())
+			if strings.Contains(v, "/") {
+				data.u8(cidrAttr, uint8(p.Bits()))
+			}
+		case "port":
+			proto, port, ok := strings.Cut(v, ":")
+			if !ok {
+				proto, port = "tcp", v
+			}
+			pn, known := protoNumbers[proto]
+			n, err := strconv.ParseUint(port, 10, 16)
+			if !known || err != nil {
+				return nil, 0, unsupported("port %s", v)
+			}
+			data.u8(attrProto, pn)
+			data.u16(attrPort, uint16(n))
+		case "mac":
+			hw, err := net.ParseMAC(v)
+			if err != nil || len(hw) != 6 {
+				return nil, 0, syntaxErr("Syntax error: cannot parse %s as ethernet address", v)
+			}
+			data.add(attrEther, hw)
+		case "iface":
+			if name, ok := strings.CutPrefix(v, "physdev:"); ok {
+				cadt |= cadtPhysdev
+				v = name
+			}
+			data.str(attrIface, v)
+		case "mark":
+			n, err := strconv.ParseUint(v, 0, 32)
+			if err != nil {
+				return nil, 0, syntaxErr("Syntax error: cannot parse %s as mark", v)
+			}
+			data.u32(attrMark, uint32(n))
+		case "set":
+			data.str(attrName, v)
+		default:
+			return nil, 0, unsupported("members of sets of dimension %s", d)
+		}
+	}
+	return data, cadt, nil
+}
+
+// names runs a command taking between min and max set names.
+func (b netlinkBackend) names(cmd uint8, args []string, min, max int) error {
+	if len(args) < min || len(args) > max {
+		return syntaxErr("Wrong number of set names")
+	}
+	a := protoAttrs()
+	if len(args) > 0 {
+		a.str(attrSetname, args[0])
+	}
+	if len(args) > 1 {
+		a.str(attrSetname2, args[1])
+	}
+	if _, err := nlRequest(cmd, nlmFAck, a); err != nil {
+		return kernelErr(cmd, err)
+	}
+	return nil
+}
+
+func (b netlinkBackend) list(c nlCommand, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return nil, syntaxErr("Wrong number of set names")
+	}
+	var name string
+	if len(args) == 1 {
+		name = args[0]
+	}
+	var flags uint32
+	switch {
+	case c.names:
+		flags = listSetname
+	case c.terse:
+		flags = listHeader
+	}
+	if !c.names && c.output != "xml" && c.output != "save" {
+		return nil, unsupported("list output %q", c.output)
+	}
+	sets, err := b.dump(name, flags)
+	if err != nil {
+		return nil, err
+	}
+	return renderList(c, sets)
+}
+
+// renderList renders listed sets in the output format of c.
+func renderList(c nlCommand, sets []SetInfo) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+	switch {
+	case c.names:
+		for _, si := range sets {
+			fmt.Fprintln(&buf, si.Name)
+		}
+	case c.output == "xml":
+		err = nlWriteXML(&buf, sets)
+	default:
+		specs := make([]SetSpec, len(sets))
+		for i, si := range sets {
+			specs[i] = nlSpec(si)
+		}
+		err = WriteRestore(&buf, specs)
+	}
+	return buf.Bytes(), err
+}
+
+// dump lists the named set, or every set, with flags selecting how much of
+// them the kernel reports.
+func (b netlinkBackend) dump(name string, flags uint32) ([]SetInfo, error) {
+	a := protoAttrs()
+	if name != "" {
+		a.str(attrSetname, name)
+	}
+	if flags != 0 {
+		a.u32(attrFlags, flags)
+	}
+	replies, err := nlRequest(ipsetCmdList, nlmFDump, a)
+	if err != nil {
+		return nil, kernelErr(ipsetCmdList, err)
+	}
+	var sets []SetInfo
+	index := make(map[string]int)
+	for _, r := range replies {
+		attrs := attrMap(r)
+		name := attrs[attrSetname].str()
+		i, ok := index[name]
+		if !ok {
+			i = len(sets)
+			index[name] = i
+			sets = append(sets, SetInfo{
+				Name:     name,
+				Type:     attrs[attrTypename].str(),
+				Revision: int(attrs[attrRevision].u8()),
+				Family:   familyName(attrs[attrFamily].u8()),
+			})
+		}
+		si := &sets[i]
+		if h, ok := attrs[attrData]; ok {
+			nlHeader(si, h.data)
+		}
+		if adt, ok := attrs[attrADT]; ok {
+			for _, d := range parseAttrs(adt.data) {
+				if d.typ == attrData {
+					si.Members = append(si.Members, nlEntry(si.Type, d.data))
+				}
+			}
+		}
+	}
+	return sets, nil
+}
+
+func nlHeader(si *SetInfo, data []byte) {
+	for _, a := range parseAttrs(data) {
+		switch a.typ {
+		case attrHashSize:
+			si.HashSize = int(a.u32())
+		case attrMaxElem:
+			si.MaxElem = int(a.u32())
+		case attrTimeout:
+			si.Timeout = int(a.u32())
+			si.timeoutExt = true
+		case attrElements:
+			si.NumEntries = int(a.u32())
+		case attrReferences:
+			si.References = int(a.u32())
+		case attrMemSize:
+			si.MemSize = int(a.u32())
+		case attrCadtFlags:
+			f := a.u32()
+			si.Counters = f&cadtWithCounters != 0
+			si.Comment = f&cadtWithComment != 0
+			si.ForceAdd = f&cadtWithForceAdd != 0
+			si.SkbInfo = f&cadtWithSkbInfo != 0
+		}
+	}
+}
+
+// nlEntry decodes a member of a set of type typ.
+func nlEntry(typ string, data []byte) Entry {
+	var e Entry
+	attrs := attrMap(data)
+	flags := attrs[attrCadtFlags].u32()
+	ips := [][2]uint16{{attrIP, attrCIDR}, {attrIP2, attrCIDR2}}
+	var parts []string
+	for _, d := range typeDims(typ) {
+		switch d {
+		case "ip", "net":
+			ip := attrs[ips[0][0]].addr()
+			v := ip.String()
+			if c, ok := attrs[ips[0][1]]; ok && int(c.u8()) < ip.BitLen() {
+				v += "/" + strconv.Itoa(int(c.u8()))
+			}
+			ips = ips[1:]
+			parts = append(parts, v)
+		case "port":
+			port := strconv.Itoa(int(attrs[attrPort].u16()))
+			if p, ok := attrs[attrProto]; ok {
+				port = protoName(p.u8()) + ":" + port
+			}
+			parts = append(parts, port)
+		case "mac":
+			parts = append(parts, strings.ToUpper(net.HardwareAddr(attrs[attrEther].data).String()))
+		case "iface":
+			v := attrs[attrIface].str()
+			if flags&cadtPhysdev != 0 {
+				v = "physdev:" + v
+			}
+			parts = append(parts, v)
+		case "mark":
+			parts = append(parts, fmt.Sprintf("0x%08x", attrs[attrMark].u32()))
+		case "set":
+			parts = append(parts, attrs[attrName].str())
+		}
+	}
+	e.Value = strings.Join(parts, ",")
+	e.Timeout = time.Duration(attrs[attrTimeout].u32()) * time.Second
+	e.Packets = attrs[attrPackets].u64()
+	e.Bytes = attrs[attrBytes].u64()
+	e.Comment = attrs[attrComment].str()
+	e.NoMatch = flags&cadtNoMatch != 0
+	return e
+}
+
+// nlSpec converts a listed set to a spec for rendering in save format.
+func nlSpec(si SetInfo) SetSpec {
+	sp := SetSpec{
+		Name:       si.Name,
+		Type:       si.Type,
+		Family:     si.Family,
+		HashSize:   si.HashSize,
+		MaxElem:    si.MaxElem,
+		Timeout:    si.Timeout,
+		Counters:   si.Counters,
+		Comment:    si.Comment,
+		TimeoutExt: si.timeoutExt,
+		Entries:    si.Members,
+	}
+	if si.ForceAdd {
+		sp.Extra = append(sp.Extra, "forceadd")
+	}
+	if si.SkbInfo {
+		sp.Extra = append(sp.Extra, "skbinfo")
+	}
+	return sp
+}
+
+// nlWriteXML renders listed sets like ipset list -output xml.
+func nlWriteXML(w io.Writer, sets []SetInfo) error {
+	present := func(b bool) *struct{} {
+		if b {
+			return &struct{}{}
+		}
+		return nil
+	}
+	var doc xmlIPSets
+	for _, si := range sets {
+		x := xmlIPSet{
+			Name:     si.Name,
+			Type:     si.Type,
+			Revision: si.Revision,
+			Header: xmlHeader{
+				Family:     si.Family,
+				HashSize:   si.HashSize,
+				MaxElem:    si.MaxElem,
+				Timeout:    si.Timeout,
+				Counters:   present(si.Counters),
+				Comment:    present(si.Comment),
+				SkbInfo:    present(si.SkbInfo),
+				ForceAdd:   present(si.ForceAdd),
+				MemSize:    si.MemSize,
+				References: si.References,
+				NumEntries: si.NumEntries,
+			},
+		}
+		for _, e := range si.Members {
+			x.Members = append(x.Members, xmlElem{
+				Elem:    e.Value,
+				Timeout: int(e.Timeout / time.Second),
+				Packets: e.Packets,
+				Bytes:   e.Bytes,
+				Comment: e.Comment,
+				NoMatch: present(e.NoMatch),
+			})
+		}
+		doc.Sets = append(doc.Sets, x)
+	}
+	return xml.NewEncoder(w).EncodeElement(doc, xml.StartElement{Name: xml.Name{Local: "ipsets"}})
+}
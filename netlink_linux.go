@@ -0,0 +1,70 @@
+package go_ipset
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"syscall"
+)
+
+var nlSeq atomic.Uint32
+
+// nlRequest sends an ipset netlink message and returns the payloads of the
+// ipset messages received in reply, up to the acknowledgement or the end of
+// the dump.
+func nlRequest(cmd uint8, flags uint16, attrs nlAttrs) ([][]byte, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_NETFILTER)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return nil, err
+	}
+
+	seq := nlSeq.Add(1)
+	msg := make([]byte, 20, 20+len(attrs))
+	binary.NativeEndian.PutUint32(msg[0:], uint32(20+len(attrs)))
+	binary.NativeEndian.PutUint16(msg[4:], nfnlSubsysIPSet<<8|uint16(cmd))
+	binary.NativeEndian.PutUint16(msg[6:], flags|syscall.NLM_F_REQUEST)
+	binary.NativeEndian.PutUint32(msg[8:], seq)
+	msg[16] = syscall.AF_INET
+	msg = append(msg, attrs...)
+	if err := syscall.Sendto(fd, msg, 0, sa); err != nil {
+		return nil, err
+	}
+
+	var replies [][]byte
+	buf := make([]byte, 1<<16)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != seq {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_ERROR, syscall.NLMSG_DONE:
+				if len(m.Data) >= 4 {
+					if code := int32(binary.NativeEndian.Uint32(m.Data)); code < 0 {
+						return nil, nlErrno(-code)
+					}
+				}
+				return replies, nil
+			default:
+				if m.Header.Type>>8 == nfnlSubsysIPSet && len(m.Data) >= 4 {
+					replies = append(replies, append([]byte(nil), m.Data[4:]...))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package go_ipset
+
+func nlRequest(cmd uint8, flags uint16, attrs nlAttrs) ([][]byte, error) {
+	return nil, ErrUnsupportedPlatform
+}
@@ -0,0 +1,64 @@
+package go_ipset
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// NftMirror copies membership changes of an ipset into an existing named
+// nftables set, keeping mixed iptables/nftables hosts consistent during a
+// migration. Only single-dimension address and network sets map cleanly.
+type NftMirror struct {
+	// Family, Table and Set name the nftables set, e.g. "inet", "filter",
+	// "blocklist".
+	Family string
+	Table  string
+	Set    string
+	// OnError receives errors of mirrored changes; it may be nil.
+	OnError func(error)
+}
+
+// Attach mirrors every change made through s from now on.
+func (m *NftMirror) Attach(s *IPSet) {
+	s.OnChange(func(added, deleted []string) {
+		if err := m.Apply(added, deleted); err != nil && m.OnError != nil {
+			m.OnError(err)
+		}
+	})
+}
+
+// Apply adds and deletes the given elements in the nftables set. Deleting
+// elements that are not there is not an error.
+func (m *NftMirror) Apply(added, deleted []string) error {
+	path, err := exec.LookPath("nft")
+	if err != nil {
+		return fmt.Errorf("nft utility not found")
+	}
+	if len(deleted) > 0 {
+		if _, err := m.run(path, "delete", deleted); err != nil {
+			// one missing element fails the whole batch; retry one by one
+			for _, entry := range deleted {
+				out, err := m.run(path, "delete", []string{entry})
+				if err != nil && !strings.Contains(string(out), "No such file") {
+					return fmt.Errorf("error deleting %s from nft set %s: %v (%s)", entry, m.Set, err, out)
+				}
+			}
+		}
+	}
+	if len(added) > 0 {
+		if out, err := m.run(path, "add", added); err != nil {
+			return fmt.Errorf("error adding to nft set %s: %v (%s)", m.Set, err, out)
+		}
+	}
+	return nil
+}
+
+func (m *NftMirror) run(path, op string, entries []string) ([]byte, error) {
+	elems := make([]string, len(entries))
+	for i, e := range entries {
+		elems[i] = strings.ReplaceAll(e, ",", " . ")
+	}
+	args := []string{op, "element", m.Family, m.Table, m.Set, "{ " + strings.Join(elems, ", ") + " }"}
+	return exec.Command(path, args...).CombinedOutput()
+}
@@ -0,0 +1,36 @@
+package go_ipset
+
+import "time"
+
+// handleOf returns a bare handle for the existing set name, for one-off
+// operations that need nothing but its name.
+func handleOf(name string) *IPSet {
+	return &IPSet{Name: name}
+}
+
+// PackageAdd adds entry to the existing set name, without a handle of its
+// own. Like every package function it discovers the backend on first use,
+// safely for concurrent callers.
+func PackageAdd(set, entry string) error {
+	return handleOf(set).AddEntry(Entry{Value: entry})
+}
+
+// PackageAddTimeout adds entry to the set name with a timeout.
+func PackageAddTimeout(set, entry string, timeout time.Duration) error {
+	return handleOf(set).AddEntry(Entry{Value: entry, Timeout: timeout})
+}
+
+// PackageDel deletes entry from the set name.
+func PackageDel(set, entry string) error {
+	return handleOf(set).Del(entry)
+}
+
+// PackageTest reports whether entry is in the set name.
+func PackageTest(set, entry string) (bool, error) {
+	return handleOf(set).Test(entry)
+}
+
+// PackageFlush removes every entry from the set name.
+func PackageFlush(set string) error {
+	return handleOf(set).Flush()
+}
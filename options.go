@@ -0,0 +1,147 @@
+package go_ipset
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option configures a set handle returned by New.
+type Option interface {
+	apply(p *Params)
+}
+
+type optionFunc func(p *Params)
+
+func (f optionFunc) apply(p *Params) {
+	f(p)
+}
+
+// apply makes *Params usable as an Option. It replaces everything set by
+// options given before it; a nil *Params is ignored.
+func (p *Params) apply(dst *Params) {
+	if p != nil {
+		*dst = *p
+	}
+}
+
+// Defaults New applies to parameters left zero.
+const (
+	DefaultHashSize = 1024
+	DefaultMaxElem  = 65536
+	DefaultFamily   = FamilyInet
+)
+
+// resolveParams applies opts in order, skipping nil ones, fills in the
+// defaults and checks the result.
+func resolveParams(opts []Option) (*Params, error) {
+	p := &Params{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.apply(p)
+		}
+	}
+	if p.HashSize == 0 {
+		p.HashSize = DefaultHashSize
+	}
+	if p.MaxElem == 0 {
+		p.MaxElem, p.defaultMaxElem = DefaultMaxElem, true
+	}
+	if p.HashFamily == "" {
+		p.HashFamily = DefaultFamily
+	}
+	switch {
+	case p.HashSize < 0:
+		return nil, fmt.Errorf("invalid hash size: %d", p.HashSize)
+	case p.MaxElem < 0:
+		return nil, fmt.Errorf("invalid maxelem: %d", p.MaxElem)
+	case !knownFamilies[p.HashFamily]:
+		return nil, fmt.Errorf("unknown family: %s", p.HashFamily)
+	}
+	if err := checkTimeout(time.Duration(p.Timeout) * time.Second); err != nil {
+		return nil, fmt.Errorf("set timeout: %w", err)
+	}
+	return p, nil
+}
+
+// WithFamily sets the address family of the set, "inet" or "inet6".
+func WithFamily(family string) Option {
+	return optionFunc(func(p *Params) {
+		p.HashFamily = family
+	})
+}
+
+// WithHashSize sets the initial hash size of the set.
+func WithHashSize(size int) Option {
+	return optionFunc(func(p *Params) {
+		p.HashSize = size
+	})
+}
+
+// WithMaxElem sets the maximum number of elements the set can hold.
+func WithMaxElem(n int) Option {
+	return optionFunc(func(p *Params) {
+		p.MaxElem = n
+	})
+}
+
+// WithTimeout sets the default entry timeout of the set, in whole seconds;
+// a partial second is rounded up.
+func WithTimeout(d time.Duration) Option {
+	return optionFunc(func(p *Params) {
+		p.Timeout = timeoutSeconds(d)
+	})
+}
+
+// WithTimeoutExtension creates the set with the timeout extension and a
+// default timeout of 0, so that entries never expire unless added with a
+// timeout of their own.
+func WithTimeoutExtension() Option {
+	return optionFunc(func(p *Params) {
+		p.TimeoutExt = true
+	})
+}
+
+// WithComment enables the comment extension on the set.
+func WithComment() Option {
+	return optionFunc(func(p *Params) {
+		p.Comment = true
+	})
+}
+
+// WithProtected protects the set, see IPSet.Protected.
+func WithProtected() Option {
+	return optionFunc(func(p *Params) {
+		p.Protected = true
+	})
+}
+
+// WithCounters enables the packet and byte counters extension on the set.
+func WithCounters() Option {
+	return optionFunc(func(p *Params) {
+		p.Counters = true
+	})
+}
+
+// WithCreate creates the set in the kernel when the handle is made.
+func WithCreate() Option {
+	return optionFunc(func(p *Params) {
+		p.Create = true
+	})
+}
+
+// WithCreateStrict creates the set in the kernel when the handle is made,
+// failing with ErrSetExists if the name is taken.
+func WithCreateStrict() Option {
+	return optionFunc(func(p *Params) {
+		p.Create = true
+		p.CreateStrict = true
+	})
+}
+
+// WithUnknownType lets New accept hash types missing from the Type*
+// constants, e.g. ones added by a newer ipset.
+func WithUnknownType() Option {
+	return optionFunc(func(p *Params) {
+		p.AllowUnknownType = true
+	})
+}
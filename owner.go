@@ -0,0 +1,145 @@
+package go_ipset
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ownerTag is the comment prefix marking the entries of the owner.
+func (s *IPSet) ownerTag() string {
+	return "owner=" + s.Owner
+}
+
+// tagComment prepends the owner tag to comment.
+func (s *IPSet) tagComment(comment string) string {
+	if s.Owner == "" {
+		return comment
+	}
+	if comment == "" {
+		return s.ownerTag()
+	}
+	return s.ownerTag() + " " + comment
+}
+
+// Owned reports whether e was added by the owner of s. Without Owner every
+// entry counts as owned.
+func (s *IPSet) Owned(e Entry) bool {
+	if s.Owner == "" {
+		return true
+	}
+	tag := s.ownerTag()
+	return e.Comment == tag || strings.HasPrefix(e.Comment, tag+" ")
+}
+
+// userComment returns comment without the owner tag and the comment
+// prefix of the defaults.
+func (s *IPSet) userComment(comment string) string {
+	if s.Owner != "" {
+		tag := s.ownerTag()
+		if comment == tag {
+			return ""
+		}
+		comment = strings.TrimPrefix(comment, tag+" ")
+	}
+	return strings.TrimPrefix(comment, s.Defaults.CommentPrefix)
+}
+
+// foreign returns the live entries of the set not added by its owner.
+func (s *IPSet) foreign() ([]Entry, error) {
+	entries, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+	var foreign []Entry
+	for _, e := range entries {
+		if !s.Owned(e) {
+			foreign = append(foreign, e)
+		}
+	}
+	return foreign, nil
+}
+
+// keepForeign adds the foreign entries back into the staging set name.
+func (s *IPSet) keepForeign(name string, foreign []Entry) error {
+	if len(foreign) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, e := range foreign {
+		buf.WriteString(addLine(name, e) + "\n")
+	}
+	return restore(s.DryRun, &buf, "-exist")
+}
+
+// OwnerFile records the names of the sets an application created, one per
+// line, so that they can be told apart from sets created by hand. Owns fits
+// Controller.Owns.
+type OwnerFile struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Owns reports whether name is recorded in the file. A missing or
+// unreadable file records nothing.
+func (f *OwnerFile) Owns(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names, _ := f.read()
+	return slices.Contains(names, name)
+}
+
+// Add records name in the file.
+func (f *OwnerFile) Add(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names, err := f.read()
+	if err != nil || slices.Contains(names, name) {
+		return err
+	}
+	return f.write(append(names, name))
+}
+
+// Remove forgets name.
+func (f *OwnerFile) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names, err := f.read()
+	if err != nil || !slices.Contains(names, name) {
+		return err
+	}
+	return f.write(slices.DeleteFunc(names, func(n string) bool { return n == name }))
+}
+
+func (f *OwnerFile) read() ([]string, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if name := strings.TrimSpace(sc.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, sc.Err()
+}
+
+func (f *OwnerFile) write(names []string) error {
+	slices.Sort(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString(name + "\n")
+	}
+	return writeFileAtomic(f.Path, buf.Bytes(), true)
+}
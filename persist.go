@@ -0,0 +1,96 @@
+package go_ipset
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Persister keeps a save-format snapshot of a set on disk, so the set can be
+// restored at boot before its first refresh.
+type Persister struct {
+	Path string
+	// Fsync flushes the snapshot and its directory to stable storage
+	// before Save returns.
+	Fsync bool
+}
+
+// Attach saves a snapshot of s after each successful Refresh. Save errors
+// are passed to onError, which may be nil.
+func (p *Persister) Attach(s *IPSet, onError func(error)) {
+	s.OnRefresh(func(s *IPSet) {
+		if err := p.Save(s); err != nil && onError != nil {
+			onError(err)
+		}
+	})
+}
+
+// Save atomically replaces the snapshot file with the current content of s.
+func (p *Persister) Save(s *IPSet) error {
+	out, err := s.save()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p.Path, out, p.Fsync)
+}
+
+// Load restores the members of s from the snapshot file, creating the set
+// if needed. It returns an error satisfying os.IsNotExist when there is no
+// snapshot yet.
+func (p *Persister) Load(s *IPSet) error {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return err
+	}
+	specs, err := ParseRestore(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", p.Path, err)
+	}
+	for i := range specs {
+		if specs[i].Name != s.Name {
+			continue
+		}
+		if err := s.create(s.Name); err != nil {
+			return err
+		}
+		return s.refresh(specs[i].Entries)
+	}
+	return fmt.Errorf("%s: no set %s in snapshot", p.Path, s.Name)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place.
+func writeFileAtomic(path string, data []byte, fsync bool) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if fsync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	if fsync {
+		d, err := os.Open(dir)
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+		return d.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package go_ipset
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Plan records the ipset commands that mutations would have run during a
+// dry run. Reads are still executed, so plans reflect the live state.
+type Plan struct {
+	mu       sync.Mutex
+	commands [][]string
+}
+
+var dryRunPlan atomic.Pointer[Plan]
+
+// SetDryRun makes every handle without its own DryRun plan record
+// mutations into p instead of executing them. A nil p ends the dry run.
+func SetDryRun(p *Plan) {
+	dryRunPlan.Store(p)
+}
+
+// Commands returns the recorded commands as ipset argument lists.
+func (p *Plan) Commands() [][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	commands := make([][]string, len(p.commands))
+	copy(commands, p.commands)
+	return commands
+}
+
+// String renders the plan as one ipset command line per recorded command.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, args := range p.Commands() {
+		b.WriteString("ipset " + strings.Join(args, " ") + "\n")
+	}
+	return b.String()
+}
+
+// Reset drops all recorded commands.
+func (p *Plan) Reset() {
+	p.mu.Lock()
+	p.commands = nil
+	p.mu.Unlock()
+}
+
+func (p *Plan) record(args []string) {
+	p.mu.Lock()
+	p.commands = append(p.commands, append([]string(nil), args...))
+	p.mu.Unlock()
+}
+
+// recordRestore records each command of a restore stream.
+func (p *Plan) recordRestore(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if fields := splitFields(sc.Text()); len(fields) > 0 && fields[0] != "COMMIT" {
+			p.record(fields)
+		}
+	}
+	return sc.Err()
+}
+
+func activePlan(p *Plan) *Plan {
+	if p != nil {
+		return p
+	}
+	return dryRunPlan.Load()
+}
+
+// mutate runs an ipset command that changes kernel state, or records it
+// when a dry run is active for s.
+func (s *IPSet) mutate(args ...string) ([]byte, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	out, ws, err := runMutation(s.DryRun, args)
+	s.notifyWarnings(ws)
+	return out, err
+}
+
+// mutateShared runs a single-entry mutation of s, which may run alongside
+// others and alongside the load of a replace, but not during its swap.
+func (s *IPSet) mutateShared(args ...string) ([]byte, error) {
+	st := stateOf(s.Name)
+	st.RLock()
+	defer st.RUnlock()
+	out, err := s.mutate(args...)
+	if err == nil {
+		st.logMutation(args)
+	}
+	return out, err
+}
+
+func mutate(p *Plan, args ...string) ([]byte, error) {
+	out, _, err := runMutation(p, args)
+	return out, err
+}
+
+// runMutation runs or records a mutation and returns its combined output
+// and, when it succeeded, its warnings.
+func runMutation(p *Plan, args []string) ([]byte, []string, error) {
+	if p = activePlan(p); p != nil {
+		p.record(args)
+		return nil, nil, nil
+	}
+	stdout, stderr, err := run(nil, args...)
+	publishMutation(args, err)
+	out := append(stdout, stderr...)
+	if err != nil {
+		return out, nil, err
+	}
+	return out, warnings(args, stderr), nil
+}
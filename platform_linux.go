@@ -0,0 +1,3 @@
+package go_ipset
+
+const supportedPlatform = true
@@ -0,0 +1,5 @@
+//go:build !linux
+
+package go_ipset
+
+const supportedPlatform = false
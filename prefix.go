@@ -0,0 +1,110 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errEmptyPrefix = errors.New("empty set name prefix")
+
+// ErrNotConfirmed is returned by FlushAll without ConfirmFlushAll.
+var ErrNotConfirmed = errors.New("flushing every set on the host requires ConfirmFlushAll")
+
+// ListNames returns the names of every set on the host.
+func ListNames() ([]string, error) {
+	if err := initCheck(); err != nil {
+		return nil, err
+	}
+	out, err := output("list", "-n")
+	if err != nil {
+		return nil, fmt.Errorf("error listing ipset names: %w (%s)", err, out)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// SetsWithPrefix returns the names of the sets DestroyAllWithPrefix and
+// FlushAllWithPrefix would affect.
+func SetsWithPrefix(prefix string) ([]string, error) {
+	if prefix == "" {
+		return nil, errEmptyPrefix
+	}
+	names, err := ListNames()
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matched = append(matched, name)
+		}
+	}
+	return matched, nil
+}
+
+// DestroyAllWithPrefix destroys every set whose name starts with prefix and
+// returns the names it destroyed. Failures are reported in a *BatchError
+// keyed by set name.
+func DestroyAllWithPrefix(prefix string) ([]string, error) {
+	return eachWithPrefix(prefix, "destroy")
+}
+
+// FlushAllWithPrefix flushes every set whose name starts with prefix and
+// returns the names it flushed. Failures are reported in a *BatchError keyed
+// by set name.
+func FlushAllWithPrefix(prefix string) ([]string, error) {
+	return eachWithPrefix(prefix, "flush")
+}
+
+func eachWithPrefix(prefix, command string) ([]string, error) {
+	names, err := SetsWithPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var done []string
+	var batch BatchError
+	for _, name := range names {
+		out, err := mutate(nil, command, name)
+		if err != nil {
+			batch.add(name, fmt.Errorf("error running %s on ipset %s: %w (%s)", command, name, err, out))
+			continue
+		}
+		done = append(done, name)
+	}
+	return done, batch.err()
+}
+
+// FlushOption changes how FlushAll behaves.
+type FlushOption func(o *flushOptions)
+
+type flushOptions struct {
+	confirmed bool
+}
+
+// ConfirmFlushAll confirms that FlushAll may empty every set on the host.
+func ConfirmFlushAll() FlushOption {
+	return func(o *flushOptions) {
+		o.confirmed = true
+	}
+}
+
+// FlushAll empties every set on the host in one command, e.g. to open the
+// firewall in an emergency. It refuses to run without ConfirmFlushAll. Use
+// Registry.FlushAll to flush only the sets of a registry.
+func FlushAll(opts ...FlushOption) error {
+	var o flushOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.confirmed {
+		return ErrNotConfirmed
+	}
+	if err := initCheck(); err != nil {
+		return err
+	}
+	out, err := mutate(nil, "flush")
+	if err != nil {
+		return fmt.Errorf("error flushing all ipsets: %w (%s)", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package go_ipset
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	profilesMu sync.Mutex
+	profiles   = make(map[string]Params)
+)
+
+// RegisterProfile registers p under name, e.g. "edge-large", for
+// NewFromProfile, replacing an earlier profile of that name.
+func RegisterProfile(name string, p Params) {
+	profilesMu.Lock()
+	profiles[name] = p
+	profilesMu.Unlock()
+}
+
+// Profile returns the parameters registered under name.
+func Profile(name string) (Params, bool) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	p, ok := profiles[name]
+	return p, ok
+}
+
+// NewFromProfile returns a handle for the set setName of type hashType
+// configured by the profile, as New does. opts are applied on top of it.
+func NewFromProfile(profile, setName, hashType string, opts ...Option) (*IPSet, error) {
+	p, ok := Profile(profile)
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", profile)
+	}
+	return New(setName, hashType, append([]Option{&p}, opts...)...)
+}
@@ -0,0 +1,55 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrProtected is returned for Flush, Destroy and calls emptying a protected
+// set, such as a Refresh or Sync with no entries, that were not forced.
+var ErrProtected = errors.New("set is protected")
+
+// ForceOption lets Flush, Destroy, Refresh and Sync proceed on a protected
+// set.
+type ForceOption bool
+
+// Force overrides the protection of a set.
+const Force ForceOption = true
+
+// guard refuses an operation wiping the content of a protected set unless
+// opts force it.
+func (s *IPSet) guard(op string, opts []ForceOption) error {
+	if !s.Protected || forced(opts) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s of set %s needs Force", ErrProtected, op, s.Name)
+}
+
+// guardRefresh refuses to swap the staging set tempName in for a protected
+// set when that would empty it, unless opts force it. A set that is empty
+// or missing anyway, e.g. right after its creation, may stay empty.
+func (s *IPSet) guardRefresh(tempName string, opts []ForceOption) error {
+	if !s.Protected || forced(opts) || activePlan(s.DryRun) != nil {
+		return nil
+	}
+	staged, err := listSets("-t", tempName)
+	if err != nil {
+		return err
+	}
+	if len(staged) != 1 || staged[0].NumEntries > 0 {
+		return nil
+	}
+	if n, err := s.Len(); err != nil || n == 0 {
+		return nil
+	}
+	return s.guard("refresh with no entries", opts)
+}
+
+func forced(opts []ForceOption) bool {
+	for _, f := range opts {
+		if f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrQuotaExceeded is matched by the *QuotaError of operations rejected by
+// a tenant quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota limits the sets of a tenant, the sets whose name starts with
+// Prefix. Zero limits are unlimited.
+type Quota struct {
+	Prefix string
+	// MaxSets limits the number of registered sets of the tenant.
+	MaxSets int
+	// MaxEntries limits the entries of each set of the tenant: Register
+	// rejects sets not created with a maxelem within it, so the kernel
+	// bounds every way of adding entries, and RefreshAll fails larger
+	// refreshes up front.
+	MaxEntries int
+}
+
+// QuotaError is returned for operations exceeding the quota of a tenant.
+// Resource is "sets" or "entries".
+type QuotaError struct {
+	Tenant   string
+	Set      string
+	Resource string
+	Limit    int
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("set %s exceeds the quota of tenant %s: at most %d %s", e.Set, e.Tenant, e.Limit, e.Resource)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// SetQuota sets the quota of the tenant q.Prefix, replacing an earlier one.
+// A set falls under the quota with the longest matching prefix. Sets
+// registered earlier are not checked again.
+func (r *Registry) SetQuota(q Quota) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.quotas {
+		if r.quotas[i].Prefix == q.Prefix {
+			r.quotas[i] = q
+			return
+		}
+	}
+	r.quotas = append(r.quotas, q)
+}
+
+// quotaFor returns the quota covering the set name, if any. r.mu must be
+// held.
+func (r *Registry) quotaFor(name string) (Quota, bool) {
+	var best Quota
+	found := false
+	for _, q := range r.quotas {
+		if strings.HasPrefix(name, q.Prefix) && (!found || len(q.Prefix) > len(best.Prefix)) {
+			best, found = q, true
+		}
+	}
+	return best, found
+}
+
+// checkQuota admits s under its quota. Under an entry quota, s needs an
+// explicit maxelem within it. r.mu must be held.
+func (r *Registry) checkQuota(s *IPSet) error {
+	q, ok := r.quotaFor(s.Name)
+	if !ok {
+		return nil
+	}
+	if q.MaxSets > 0 {
+		n := 0
+		for _, other := range r.sets {
+			if tq, ok := r.quotaFor(other.Name); ok && tq.Prefix == q.Prefix {
+				n++
+			}
+		}
+		if n >= q.MaxSets {
+			return &QuotaError{Tenant: q.Prefix, Set: s.Name, Resource: "sets", Limit: q.MaxSets}
+		}
+	}
+	if q.MaxEntries > 0 && (s.defaultMaxElem || s.MaxElem <= 0 || s.MaxElem > q.MaxEntries) {
+		return &QuotaError{Tenant: q.Prefix, Set: s.Name, Resource: "entries", Limit: q.MaxEntries}
+	}
+	return nil
+}
+
+// checkEntries rejects loading n entries into s beyond its quota.
+func (r *Registry) checkEntries(s *IPSet, n int) error {
+	r.mu.Lock()
+	q, ok := r.quotaFor(s.Name)
+	r.mu.Unlock()
+	if ok && q.MaxEntries > 0 && n > q.MaxEntries {
+		return &QuotaError{Tenant: q.Prefix, Set: s.Name, Resource: "entries", Limit: q.MaxEntries}
+	}
+	return nil
+}
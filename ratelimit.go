@@ -0,0 +1,45 @@
+package go_ipset
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter adds an address to a penalty set once it is observed more than
+// Limit times within Window. The ban is left to the kernel to expire after
+// Penalty, so the set needs the timeout extension. Limit and Window take
+// effect with the first Observe and must not change afterwards.
+type RateLimiter struct {
+	Set     *IPSet
+	Limit   int
+	Window  time.Duration
+	Penalty time.Duration
+
+	once sync.Once
+	rate *slidingWindow
+}
+
+// NewRateLimiter returns a RateLimiter adding offenders to set.
+func NewRateLimiter(set *IPSet, limit int, window, penalty time.Duration) *RateLimiter {
+	return &RateLimiter{
+		Set:     set,
+		Limit:   limit,
+		Window:  window,
+		Penalty: penalty,
+	}
+}
+
+// Observe records one event from ip and reports whether it pushed ip over
+// the limit, in which case ip has been added to the penalty set.
+func (r *RateLimiter) Observe(ip string) (bool, error) {
+	r.once.Do(func() {
+		r.rate = newSlidingWindow(r.Limit+1, r.Window)
+	})
+	if !r.rate.observe(ip, time.Now()) {
+		return false, nil
+	}
+	if err := r.Set.AddEntry(Entry{Value: ip, Timeout: r.Penalty}); err != nil {
+		return true, err
+	}
+	return true, nil
+}
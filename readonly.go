@@ -0,0 +1,53 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrReadOnly is returned by mutations refused in read-only mode.
+var ErrReadOnly = errors.New("read-only mode")
+
+var readOnlyMode atomic.Bool
+
+// SetReadOnly switches the package into or out of read-only mode, in which
+// every command changing kernel state fails with ErrReadOnly while reads
+// keep working, e.g. for observe-only deployments. Dry runs still record
+// their plans. See also IPSet.ReadOnly.
+func SetReadOnly(on bool) {
+	readOnlyMode.Store(on)
+}
+
+// checkReadOnly refuses the mutating commands in read-only mode.
+func checkReadOnly(args []string) error {
+	if readOnlyMode.Load() && !readOnly(args) {
+		return fmt.Errorf("%w: ipset %s", ErrReadOnly, strings.Join(args, " "))
+	}
+	return nil
+}
+
+// writable refuses changes through a read-only handle, unless they are
+// only recorded into a dry-run plan.
+func (s *IPSet) writable() error {
+	if s.ReadOnly && activePlan(s.DryRun) == nil {
+		return fmt.Errorf("%w: set %s", ErrReadOnly, s.Name)
+	}
+	return nil
+}
+
+// readOnly reports whether the ipset command only reads kernel state.
+func readOnly(args []string) bool {
+	for _, a := range args {
+		if strings.HasPrefix(a, "-") && a != "-L" && a != "-S" && a != "-T" && a != "-V" {
+			continue
+		}
+		switch a {
+		case "list", "-L", "save", "-S", "test", "-T", "version", "-V", "help":
+			return true
+		}
+		return false
+	}
+	return false
+}
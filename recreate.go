@@ -0,0 +1,167 @@
+package go_ipset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Exists reports whether the set exists in the kernel.
+func (s *IPSet) Exists() (bool, error) {
+	return setExists(s.Name)
+}
+
+func setExists(name string) (bool, error) {
+	out, err := combinedOutput("list", "-n", name)
+	if err == nil {
+		return true, nil
+	}
+	if strings.Contains(string(out), "does not exist") {
+		return false, nil
+	}
+	return false, fmt.Errorf("error checking set %s: %w (%s)", name, err, out)
+}
+
+// RecreateGuard watches managed sets and recreates any that vanished, e.g.
+// after a manual ipset destroy, repopulating them with the content of their
+// last Refresh or ApplySpec and the entries added and deleted through the
+// handle since. Added entries keep what is left of their timeout.
+type RecreateGuard struct {
+	Sets     []*IPSet
+	Interval time.Duration
+	// OnRecreate is called for every set found missing, with the error of
+	// recreating it; it may be nil.
+	OnRecreate func(s *IPSet, err error)
+}
+
+// Run checks the sets every Interval, which must be positive, until ctx
+// is done.
+func (g *RecreateGuard) Run(ctx context.Context) error {
+	if g.Interval <= 0 {
+		return fmt.Errorf("recreate guard interval %v is not positive", g.Interval)
+	}
+	t := time.NewTicker(g.Interval)
+	defer t.Stop()
+	for {
+		g.Check()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Check recreates the missing sets once. Failures are reported in a
+// *BatchError keyed by set name.
+func (g *RecreateGuard) Check() error {
+	var batch BatchError
+	for _, s := range g.Sets {
+		ok, err := s.Exists()
+		if err == nil && ok {
+			continue
+		}
+		if err == nil {
+			err = s.recreate()
+			if g.OnRecreate != nil {
+				g.OnRecreate(s, err)
+			}
+		}
+		batch.add(s.Name, err)
+	}
+	return batch.err()
+}
+
+func (s *IPSet) recreate() error {
+	if err := s.create(s.Name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	desired := s.intended(time.Now())
+	s.mu.Unlock()
+	return s.refresh(desired)
+}
+
+// trackedEntry is an entry added through the handle at a given time.
+type trackedEntry struct {
+	Entry
+	at time.Time
+}
+
+// track records a successful single-entry add or delete of e, so that
+// recreate restores it.
+func (s *IPSet) track(e Entry, add bool) {
+	if activePlan(s.DryRun) != nil {
+		return
+	}
+	key := canonical(s.HashType, e.Value)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.added, key)
+		if s.deleted == nil {
+			s.deleted = make(map[string]bool)
+		}
+		s.deleted[key] = true
+		return
+	}
+	delete(s.deleted, key)
+	if s.added == nil {
+		s.added = make(map[string]trackedEntry)
+	}
+	s.added[key] = trackedEntry{Entry: e, at: now}
+	if len(s.added)+len(s.deleted) > s.trackLimit {
+		s.pruneTracked(now)
+	}
+}
+
+// pruneTracked drops the added entries that expired and the deletions of
+// entries not desired anyway, keeping the tracking proportional to the live
+// content. It is called with s.mu held.
+func (s *IPSet) pruneTracked(now time.Time) {
+	for key, t := range s.added {
+		if t.Timeout > 0 && now.Sub(t.at) >= t.Timeout {
+			delete(s.added, key)
+		}
+	}
+	want := make(map[string]bool, len(s.desired))
+	for _, e := range s.desired {
+		want[canonical(s.HashType, e.Value)] = true
+	}
+	for key := range s.deleted {
+		if !want[key] {
+			delete(s.deleted, key)
+		}
+	}
+	s.trackLimit = max(2*(len(s.added)+len(s.deleted)), 1024)
+}
+
+// intended returns the desired content of the set with the tracked
+// mutations applied, the added entries with their remaining timeout. It is
+// called with s.mu held.
+func (s *IPSet) intended(now time.Time) []Entry {
+	if len(s.added) == 0 && len(s.deleted) == 0 {
+		return s.desired
+	}
+	var entries []Entry
+	for _, e := range s.desired {
+		key := canonical(s.HashType, e.Value)
+		if _, ok := s.added[key]; !ok && !s.deleted[key] {
+			entries = append(entries, e)
+		}
+	}
+	for _, t := range s.added {
+		e := t.Entry
+		if e.Timeout > 0 {
+			left := e.Timeout - now.Sub(t.at)
+			if left < time.Second {
+				continue
+			}
+			e.Timeout = left
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
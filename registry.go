@@ -0,0 +1,107 @@
+package go_ipset
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry owns a group of related sets and hands them out by logical name.
+// Quotas set with SetQuota bound what each tenant may register and load.
+type Registry struct {
+	mu     sync.Mutex
+	sets   map[string]*IPSet
+	order  []string
+	quotas []Quota
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{sets: make(map[string]*IPSet)}
+}
+
+// Register adds s under the logical name. A set beyond the quota of its
+// tenant is rejected with a *QuotaError; with an entry quota, that includes
+// a set without an explicit MaxElem, which the kernel would not bound by
+// the quota.
+func (r *Registry) Register(name string, s *IPSet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sets[name]; ok {
+		return fmt.Errorf("set %s already registered", name)
+	}
+	if err := r.checkQuota(s); err != nil {
+		return err
+	}
+	r.sets[name] = s
+	r.order = append(r.order, name)
+	return nil
+}
+
+// Get returns the set registered under name.
+func (r *Registry) Get(name string) (*IPSet, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.sets[name]
+	return s, ok
+}
+
+// Names returns the logical names in registration order.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.order...)
+}
+
+// CreateAll creates every registered set that doesn't exist yet.
+func (r *Registry) CreateAll() error {
+	return r.each(func(s *IPSet) error {
+		return s.create(s.Name)
+	})
+}
+
+// FlushAll flushes every registered set.
+func (r *Registry) FlushAll() error {
+	return r.each(func(s *IPSet) error { return s.Flush() })
+}
+
+// DestroyAll destroys every registered set. The sets stay registered.
+func (r *Registry) DestroyAll() error {
+	return r.each(func(s *IPSet) error { return s.Destroy() })
+}
+
+// RefreshAll refreshes the sets named in entries, keyed by logical name.
+// Lists beyond the entry quota of their set fail with a *QuotaError.
+func (r *Registry) RefreshAll(entries map[string][]string) error {
+	for name := range entries {
+		if _, ok := r.Get(name); !ok {
+			return fmt.Errorf("set %s not registered", name)
+		}
+	}
+	return r.eachNamed(func(name string, s *IPSet) error {
+		list, ok := entries[name]
+		if !ok {
+			return nil
+		}
+		if err := r.checkEntries(s, len(list)); err != nil {
+			return err
+		}
+		return s.Refresh(list)
+	})
+}
+
+// each runs fn on every set in registration order. All sets are attempted;
+// failures are reported in a *BatchError keyed by logical name.
+func (r *Registry) each(fn func(s *IPSet) error) error {
+	return r.eachNamed(func(_ string, s *IPSet) error {
+		return fn(s)
+	})
+}
+
+func (r *Registry) eachNamed(fn func(name string, s *IPSet) error) error {
+	var batch BatchError
+	for _, name := range r.Names() {
+		s, _ := r.Get(name)
+		batch.add(name, fn(name, s))
+	}
+	return batch.err()
+}
@@ -0,0 +1,213 @@
+package go_ipset
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const snapshotMagic = "ipset-snapshot-v1"
+
+var (
+	// ErrBadSignature is returned for snapshots not signed with the
+	// replica's key.
+	ErrBadSignature = errors.New("snapshot signature mismatch")
+	// ErrStaleGeneration is returned for snapshots not newer than the one
+	// last applied.
+	ErrStaleGeneration = errors.New("snapshot generation not newer than applied one")
+	// ErrNoKey is returned by Export and Apply without a key, as anyone
+	// could sign snapshots with an empty one.
+	ErrNoKey = errors.New("snapshot key is empty")
+)
+
+// Publisher exports signed, generation-numbered snapshots of sets for
+// replicas to apply.
+type Publisher struct {
+	Key  []byte
+	Sets []*IPSet
+
+	mu         sync.Mutex
+	generation uint64
+	// sum is the checksum of the content of generation.
+	sum [sha256.Size]byte
+}
+
+// Export writes a signed snapshot of the sets to w and returns its
+// generation. Generations derive from the clock, so they keep increasing
+// across restarts of the publisher; unchanged content keeps the generation
+// of the previous export. Exports are serialized, so a higher generation
+// never carries older content.
+func (p *Publisher) Export(w io.Writer) (uint64, error) {
+	if len(p.Key) == 0 {
+		return 0, ErrNoKey
+	}
+	p.mu.Lock()
+	gen := uint64(time.Now().UnixNano())
+	if gen <= p.generation {
+		gen = p.generation + 1
+	}
+	var body bytes.Buffer
+	for _, s := range p.Sets {
+		out, err := s.save()
+		if err != nil {
+			p.mu.Unlock()
+			return 0, err
+		}
+		body.Write(out)
+	}
+	sum := sha256.Sum256(body.Bytes())
+	if p.generation != 0 && sum == p.sum {
+		gen = p.generation
+	}
+	p.generation, p.sum = gen, sum
+	p.mu.Unlock()
+	sig := signSnapshot(p.Key, gen, body.Bytes())
+	if _, err := fmt.Fprintf(w, "%s %d %s\n", snapshotMagic, gen, sig); err != nil {
+		return 0, err
+	}
+	_, err := w.Write(body.Bytes())
+	return gen, err
+}
+
+// ServeHTTP serves a fresh snapshot on every request, tagged with its
+// generation as ETag; a request whose If-None-Match names the current
+// generation gets 304 Not Modified.
+func (p *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	gen, err := p.Export(&buf)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	etag := strconv.Quote(strconv.FormatUint(gen, 10))
+	w.Header().Set("ETag", etag)
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Ipset-Generation", strconv.FormatUint(gen, 10))
+	sum := sha256.Sum256(buf.Bytes())
+	w.Header().Set(ChecksumHeader, hex.EncodeToString(sum[:]))
+	w.Write(buf.Bytes())
+}
+
+// etagMatch reports whether the If-None-Match header value header names
+// etag, compared weakly.
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Replica applies snapshots exported by a Publisher sharing its key,
+// refusing any that are not newer than the last one applied.
+type Replica struct {
+	Key []byte
+	// StateFile keeps the generation of the last applied snapshot across
+	// restarts. Without it, a restarted replica accepts any validly signed
+	// snapshot, however old, once.
+	StateFile string
+
+	mu         sync.Mutex
+	loaded     bool
+	generation uint64
+}
+
+// Generation returns the generation of the last applied snapshot.
+func (r *Replica) Generation() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// an unreadable state file is reported by Apply
+	r.load()
+	return r.generation
+}
+
+// load reads the generation from StateFile on first use; r.mu is held.
+func (r *Replica) load() error {
+	if r.loaded || r.StateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(r.StateFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		gen, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: bad generation %q", r.StateFile, data)
+		}
+		r.generation = gen
+	}
+	r.loaded = true
+	return nil
+}
+
+// Apply verifies the snapshot read from rd and atomically replaces the
+// content of every set in it.
+func (r *Replica) Apply(rd io.Reader) error {
+	if len(r.Key) == 0 {
+		return ErrNoKey
+	}
+	br := bufio.NewReader(rd)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("error reading snapshot header: %v", err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[0] != snapshotMagic {
+		return fmt.Errorf("not an ipset snapshot")
+	}
+	gen, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad snapshot generation %s", fields[1])
+	}
+	body, err := io.ReadAll(br)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(signSnapshot(r.Key, gen, body)), []byte(fields[2])) {
+		return ErrBadSignature
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.load(); err != nil {
+		return fmt.Errorf("error reading replica state: %v", err)
+	}
+	if gen <= r.generation {
+		return fmt.Errorf("%w: %d <= %d", ErrStaleGeneration, gen, r.generation)
+	}
+	if err := applySnapshot(body); err != nil {
+		return err
+	}
+	r.generation = gen
+	if r.StateFile != "" {
+		data := []byte(strconv.FormatUint(gen, 10) + "\n")
+		if err := writeFileAtomic(r.StateFile, data, true); err != nil {
+			return fmt.Errorf("snapshot %d applied, but error saving replica state: %v", gen, err)
+		}
+	}
+	return nil
+}
+
+func signSnapshot(key []byte, gen uint64, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%d\n", gen)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,60 @@
+package go_ipset
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// RetryPolicy bounds the retries of commands failing with transient kernel
+// errors, such as a busy resource under heavy concurrent ipset use.
+type RetryPolicy struct {
+	// Attempts is the number of times a command is run at most; 1 or less
+	// disables retries.
+	Attempts int
+	// Backoff is the delay before the first retry; it doubles with every
+	// further one.
+	Backoff time.Duration
+}
+
+// DefaultRetryPolicy is the policy in effect until SetRetryPolicy is called.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 50 * time.Millisecond}
+
+var (
+	retryMu     sync.Mutex
+	retryPolicy = DefaultRetryPolicy
+)
+
+// SetRetryPolicy sets how commands failing with transient kernel errors
+// are retried. Commands reading a restore stream are never retried.
+func SetRetryPolicy(p RetryPolicy) {
+	retryMu.Lock()
+	retryPolicy = p
+	retryMu.Unlock()
+}
+
+func currentRetryPolicy() RetryPolicy {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+	return retryPolicy
+}
+
+// transientErrors are the stderr fragments of failures worth retrying.
+var transientErrors = [][]byte{
+	[]byte("resource busy"),
+	[]byte("try later"),
+	[]byte("temporarily unavailable"),
+	[]byte("no buffer space available"),
+}
+
+// transient reports whether stderr tells of a failure that may go away
+// when the command is run again.
+func transient(stderr []byte) bool {
+	stderr = bytes.ToLower(stderr)
+	for _, t := range transientErrors {
+		if bytes.Contains(stderr, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package go_ipset
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SaveAll writes every set on the host, with its members, to w in the
+// format read by RestoreAll (ipset save).
+func SaveAll(w io.Writer) error {
+	if err := initCheck(); err != nil {
+		return err
+	}
+	out, stderr, err := run(nil, "save")
+	if err != nil {
+		return fmt.Errorf("error saving ipsets: %w (%s)", err, stderr)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// RestoreAll loads sets and members from r, as written by SaveAll
+// (ipset restore). Existing sets are not removed.
+func RestoreAll(r io.Reader) error {
+	if err := initCheck(); err != nil {
+		return err
+	}
+	return restore(nil, r)
+}
+
+// restore feeds r to ipset restore, or records it when a dry run is active.
+func restore(p *Plan, r io.Reader, flags ...string) error {
+	if p := activePlan(p); p != nil {
+		return p.recordRestore(r)
+	}
+	stdout, stderr, err := run(r, append(flags, "restore")...)
+	out := append(stdout, stderr...)
+	if err != nil {
+		return fmt.Errorf("error restoring ipsets: %w (%s)", err, out)
+	}
+	warnings(append(flags, "restore"), stderr)
+	return nil
+}
+
+// save returns the set in save format.
+func (s *IPSet) save() ([]byte, error) {
+	out, err := output("save", s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error listing set %s: %w (%s)", s.Name, err, out)
+	}
+	return out, nil
+}
+
+// entries returns the members of the set with their options, as reported by
+// ipset save.
+func (s *IPSet) entries() ([]Entry, error) {
+	var entries []Entry
+	for e, err := range s.AllErr() {
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *IPSet) members() ([]string, error) {
+	entries, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, len(entries))
+	for i, e := range entries {
+		members[i] = e.Value
+	}
+	return members, nil
+}
+
+// parseEntry builds an Entry from a member value and the option words that
+// follow it on an add line.
+func parseEntry(value string, opts []string) Entry {
+	e := Entry{Value: value}
+	for i := 0; i < len(opts); i++ {
+		if opts[i] == "nomatch" {
+			e.NoMatch = true
+			continue
+		}
+		if i+1 == len(opts) {
+			break
+		}
+		switch opts[i] {
+		case "timeout":
+			if n, err := strconv.Atoi(opts[i+1]); err == nil {
+				e.Timeout = time.Duration(n) * time.Second
+				e.Permanent = n == 0
+			}
+		case "comment":
+			e.Comment = opts[i+1]
+		case "packets":
+			e.Packets, _ = strconv.ParseUint(opts[i+1], 10, 64)
+		case "bytes":
+			e.Bytes, _ = strconv.ParseUint(opts[i+1], 10, 64)
+		case "skbmark", "skbprio", "skbqueue":
+			e.setSkb(opts[i], opts[i+1])
+		default:
+			continue
+		}
+		i++
+	}
+	return e
+}
+
+// splitFields splits a save-format line on whitespace, keeping double-quoted
+// words such as comments together and unquoted.
+func splitFields(line string) []string {
+	var (
+		fields []string
+		cur    strings.Builder
+		quoted bool
+		inWord bool
+	)
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\r'):
+			if inWord {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+// Entries returns the members of the set with their extensions: remaining
+// timeout, comment and counters.
+func (s *IPSet) Entries() ([]Entry, error) {
+	return s.entries()
+}
+
+// Remaining returns how long entry stays in the set before it expires. ok
+// is false if the entry is not in the set; a zero duration with ok means
+// the entry does not expire.
+func (s *IPSet) Remaining(entry string) (d time.Duration, ok bool, err error) {
+	entries, err := s.entries()
+	if err != nil {
+		return 0, false, err
+	}
+	c := canonical(s.HashType, entry)
+	for _, e := range entries {
+		if canonical(s.HashType, e.Value) == c {
+			return e.Timeout, true, nil
+		}
+	}
+	return 0, false, nil
+}
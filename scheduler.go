@@ -0,0 +1,216 @@
+package go_ipset
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Source returns the entries a scheduled set should hold.
+type Source func(ctx context.Context) ([]string, error)
+
+// Job describes how a Scheduler refreshes one set.
+type Job struct {
+	Set      *IPSet
+	Source   Source
+	Interval time.Duration
+	// Jitter spreads refreshes by up to this fraction of the delay in
+	// either direction, e.g. 0.1 for ±10%.
+	Jitter float64
+	// RetryMin is the delay before the first retry after a failure; it
+	// doubles with every further failure, up to Interval. Defaults to 5s.
+	RetryMin time.Duration
+	// StaleAfter flushes the set once no refresh succeeded for that long.
+	// Zero keeps serving the last loaded content indefinitely.
+	StaleAfter time.Duration
+}
+
+// JobStatus reports the outcome of the refreshes of a job.
+type JobStatus struct {
+	LastAttempt time.Time
+	LastSuccess time.Time
+	LastError   error
+	Failures    int
+	Stale       bool
+}
+
+// Scheduler periodically refreshes sets from their sources.
+type Scheduler struct {
+	// Systemd enables sd_notify integration in Run: READY=1 once every job
+	// completed its first refresh, and watchdog pings while every job keeps
+	// refreshing and none went stale.
+	Systemd bool
+
+	mu     sync.Mutex
+	jobs   []*scheduledJob
+	status map[string]JobStatus
+}
+
+type scheduledJob struct {
+	Job
+	started time.Time
+}
+
+// NewScheduler returns an empty Scheduler.
+func NewScheduler() *Scheduler {
+	return &Scheduler{status: make(map[string]JobStatus)}
+}
+
+// Add registers j. Jobs added after Run was called are not started.
+func (sc *Scheduler) Add(j Job) {
+	if j.RetryMin == 0 {
+		j.RetryMin = 5 * time.Second
+	}
+	sc.mu.Lock()
+	sc.jobs = append(sc.jobs, &scheduledJob{Job: j})
+	sc.mu.Unlock()
+}
+
+// Status returns the status of every job, keyed by set name.
+func (sc *Scheduler) Status() map[string]JobStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	status := make(map[string]JobStatus, len(sc.status))
+	for name, st := range sc.status {
+		status[name] = st
+	}
+	return status
+}
+
+// Run refreshes every job right away and then on its interval until ctx is
+// done.
+func (sc *Scheduler) Run(ctx context.Context) error {
+	sc.mu.Lock()
+	jobs := append([]*scheduledJob(nil), sc.jobs...)
+	sc.mu.Unlock()
+	var wg, loaded sync.WaitGroup
+	loaded.Add(len(jobs))
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *scheduledJob) {
+			defer wg.Done()
+			sc.runJob(ctx, j, loaded.Done)
+		}(j)
+	}
+	if sc.Systemd {
+		go sc.notify(ctx, jobs, &loaded)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (sc *Scheduler) runJob(ctx context.Context, j *scheduledJob, loaded func()) {
+	j.started = time.Now()
+	for first := true; ; first = false {
+		delay := sc.refresh(ctx, j)
+		if first {
+			loaded()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jitter(delay, j.Jitter)):
+		}
+	}
+}
+
+// refresh runs one refresh of j, records its outcome and returns the delay
+// until the next one.
+func (sc *Scheduler) refresh(ctx context.Context, j *scheduledJob) time.Duration {
+	entries, err := j.Source(ctx)
+	if err == nil {
+		err = j.Set.RefreshContext(ctx, entries)
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	st := sc.status[j.Set.Name]
+	st.LastAttempt = time.Now()
+	st.LastError = err
+	if err == nil {
+		st.LastSuccess = st.LastAttempt
+		st.Failures = 0
+		st.Stale = false
+		sc.status[j.Set.Name] = st
+		return j.Interval
+	}
+	st.Failures++
+	last := st.LastSuccess
+	if last.IsZero() {
+		last = j.started
+	}
+	if j.StaleAfter > 0 && !st.Stale && time.Since(last) > j.StaleAfter {
+		if j.Set.Flush() == nil {
+			st.Stale = true
+		}
+	}
+	sc.status[j.Set.Name] = st
+	delay := j.RetryMin << min(st.Failures-1, 30)
+	if delay <= 0 || delay > j.Interval {
+		delay = j.Interval
+	}
+	return delay
+}
+
+// jitter randomizes d by up to ±frac of it.
+func jitter(d time.Duration, frac float64) time.Duration {
+	if frac <= 0 {
+		return d
+	}
+	return d + time.Duration((rand.Float64()*2-1)*frac*float64(d))
+}
+
+// notify signals readiness to systemd once the first refresh of every job
+// completed and then pets the watchdog while the jobs are healthy.
+func (sc *Scheduler) notify(ctx context.Context, jobs []*scheduledJob, loaded *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		loaded.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return
+	case <-done:
+	}
+	failed := 0
+	for _, st := range sc.Status() {
+		if st.LastError != nil {
+			failed++
+		}
+	}
+	SdNotify(fmt.Sprintf("READY=1\nSTATUS=%d sets loaded, %d failed", len(jobs)-failed, failed))
+	defer SdNotify("STOPPING=1")
+	interval := SdWatchdogInterval() / 2
+	if interval <= 0 {
+		<-ctx.Done()
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if sc.healthy(jobs) {
+				SdNotify("WATCHDOG=1")
+			}
+		}
+	}
+}
+
+// healthy reports whether every job attempted a refresh within twice its
+// interval and none went stale.
+func (sc *Scheduler) healthy(jobs []*scheduledJob) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for _, j := range jobs {
+		st := sc.status[j.Set.Name]
+		if st.Stale || time.Since(st.LastAttempt) > 2*j.Interval {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package go_ipset
+
+import (
+	"net/netip"
+	"sort"
+)
+
+// Union atomically replaces the content of dst with the combined members of
+// srcs.
+func Union(dst *IPSet, srcs ...*IPSet) error {
+	lists, err := memberLists(srcs)
+	if err != nil {
+		return err
+	}
+	return dst.refresh(toEntries(unionOf(dst.HashType, lists)))
+}
+
+// Intersect atomically replaces the content of dst with the members present
+// in both a and b. For hash:net sets, a network is kept where it lies within
+// a network of the other side.
+func Intersect(dst, a, b *IPSet) error {
+	lists, err := memberLists([]*IPSet{a, b})
+	if err != nil {
+		return err
+	}
+	return dst.refresh(toEntries(intersectOf(dst.HashType, lists[0], lists[1])))
+}
+
+// Subtract atomically replaces the content of dst with the members of a
+// that are not in b, e.g. a blocklist minus an allowlist. For hash:net sets
+// networks of a are split around the networks of b.
+func Subtract(dst, a, b *IPSet) error {
+	lists, err := memberLists([]*IPSet{a, b})
+	if err != nil {
+		return err
+	}
+	return dst.refresh(toEntries(subtractOf(dst.HashType, lists[0], lists[1])))
+}
+
+func memberLists(sets []*IPSet) ([][]string, error) {
+	lists := make([][]string, len(sets))
+	for i, s := range sets {
+		members, err := s.members()
+		if err != nil {
+			return nil, err
+		}
+		lists[i] = members
+	}
+	return lists, nil
+}
+
+func toEntries(values []string) []Entry {
+	entries := make([]Entry, len(values))
+	for i, v := range values {
+		entries[i] = Entry{Value: v}
+	}
+	return entries
+}
+
+func unionOf(hashType string, lists [][]string) []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, list := range lists {
+		for _, m := range list {
+			c := canonical(hashType, m)
+			if !seen[c] {
+				seen[c] = true
+				res = append(res, m)
+			}
+		}
+	}
+	return res
+}
+
+func intersectOf(hashType string, a, b []string) []string {
+	var res []string
+	if isNetType(hashType) {
+		seen := make(map[netip.Prefix]bool)
+		for _, p := range prefixes(a) {
+			for _, q := range prefixes(b) {
+				if !p.Overlaps(q) {
+					continue
+				}
+				r := p
+				if q.Bits() > p.Bits() {
+					r = q
+				}
+				if !seen[r] {
+					seen[r] = true
+					res = append(res, r.String())
+				}
+			}
+		}
+		return res
+	}
+	in := make(map[string]bool, len(b))
+	for _, m := range b {
+		in[canonical(hashType, m)] = true
+	}
+	for _, m := range a {
+		if in[canonical(hashType, m)] {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func subtractOf(hashType string, a, b []string) []string {
+	if !isNetType(hashType) {
+		_, onlyA := diffEntries(hashType, a, b)
+		return onlyA
+	}
+	remaining := prefixes(a)
+	for _, q := range prefixes(b) {
+		var next []netip.Prefix
+		for _, p := range remaining {
+			next = append(next, subtractPrefix(p, q)...)
+		}
+		remaining = next
+	}
+	res := make([]string, len(remaining))
+	for i, p := range remaining {
+		res[i] = p.String()
+	}
+	return res
+}
+
+// isNetType reports whether the set type holds plain networks, the only
+// types whose members CIDR-aware set operations can reshape.
+func isNetType(hashType string) bool {
+	return hashType == TypeHashNet
+}
+
+func prefixes(members []string) []netip.Prefix {
+	var ps []netip.Prefix
+	for _, m := range members {
+		if p, ok := parsePrefix(m); ok {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// subtractPrefix returns the parts of p not covered by q.
+func subtractPrefix(p, q netip.Prefix) []netip.Prefix {
+	if !p.Overlaps(q) {
+		return []netip.Prefix{p}
+	}
+	if q.Bits() <= p.Bits() {
+		return nil
+	}
+	lo, hi := splitPrefix(p)
+	if lo.Contains(q.Addr()) {
+		return append(subtractPrefix(lo, q), hi)
+	}
+	return append([]netip.Prefix{lo}, subtractPrefix(hi, q)...)
+}
+
+// splitPrefix splits p into its two halves.
+func splitPrefix(p netip.Prefix) (lo, hi netip.Prefix) {
+	bits := p.Bits() + 1
+	b := p.Addr().AsSlice()
+	lo = netip.PrefixFrom(p.Addr(), bits)
+	b[p.Bits()/8] |= 0x80 >> (p.Bits() % 8)
+	a, _ := netip.AddrFromSlice(b)
+	hi = netip.PrefixFrom(a, bits)
+	return lo, hi
+}
+
+// AggregatePrefixes returns the smallest list of prefixes covering exactly
+// the same addresses as ps: covered prefixes are dropped and adjacent
+// halves merged.
+func AggregatePrefixes(ps []netip.Prefix) []netip.Prefix {
+	res := make([]netip.Prefix, 0, len(ps))
+	for _, p := range ps {
+		res = append(res, p.Masked())
+	}
+	for {
+		sort.Slice(res, func(i, j int) bool {
+			if c := res[i].Addr().Compare(res[j].Addr()); c != 0 {
+				return c < 0
+			}
+			return res[i].Bits() < res[j].Bits()
+		})
+		var out []netip.Prefix
+		merged := false
+		for _, p := range res {
+			if n := len(out); n > 0 {
+				last := out[n-1]
+				if last.Bits() <= p.Bits() && last.Contains(p.Addr()) {
+					continue
+				}
+				if last.Bits() == p.Bits() && last.Bits() > 0 {
+					parent := netip.PrefixFrom(last.Addr(), last.Bits()-1).Masked()
+					if parent.Addr() == last.Addr() && parent.Contains(p.Addr()) {
+						out[n-1] = parent
+						merged = true
+						continue
+					}
+				}
+			}
+			out = append(out, p)
+		}
+		res = out
+		if !merged {
+			return res
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package go_ipset
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// ShardedSet spreads the entries of one logical set over several kernel
+// sets by hash, for contents beyond what a single set comfortably holds.
+// The shards are named after the logical set with the shard number
+// appended, e.g. feed-0 to feed-3, and each takes the options given to
+// NewSharded, so MaxElem applies per shard.
+type ShardedSet struct {
+	Name     string
+	HashType string
+	Shards   []*IPSet
+}
+
+// NewSharded returns a handle for the logical set name spread over n
+// shards of type hashtype, configured by opts as with New.
+func NewSharded(name, hashtype string, n int, opts ...Option) (*ShardedSet, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid shard count %d", n)
+	}
+	ss := &ShardedSet{Name: name, HashType: hashtype}
+	for i := 0; i < n; i++ {
+		shard := name + "-" + strconv.Itoa(i)
+		if err := ValidName(shard); err != nil {
+			return nil, err
+		}
+		s, err := New(shard, hashtype, opts...)
+		if err != nil {
+			return nil, err
+		}
+		ss.Shards = append(ss.Shards, s)
+	}
+	return ss, nil
+}
+
+// Shard returns the shard holding entry.
+func (ss *ShardedSet) Shard(entry string) *IPSet {
+	h := fnv.New32a()
+	h.Write([]byte(canonical(ss.HashType, entry)))
+	return ss.Shards[h.Sum32()%uint32(len(ss.Shards))]
+}
+
+// Add adds entry to its shard, as IPSet.Add does.
+func (ss *ShardedSet) Add(entry string, timeout int, opts ...AddOption) error {
+	return ss.Shard(entry).Add(entry, timeout, opts...)
+}
+
+// Del deletes entry from its shard.
+func (ss *ShardedSet) Del(entry string) error {
+	return ss.Shard(entry).Del(entry)
+}
+
+// Test reports whether entry is in the set. With network dimensions an
+// address may match a network stored in any shard, so all are tested.
+func (ss *ShardedSet) Test(entry string) (bool, error) {
+	if !strings.Contains(ss.HashType, "net") {
+		return ss.Shard(entry).Test(entry)
+	}
+	for _, s := range ss.Shards {
+		ok, err := s.Test(entry)
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// Refresh replaces the content of the set with entries, refreshing every
+// shard with its part. Shards are refreshed one after the other, so the
+// set is briefly a mix of old and new content. Failures are reported in a
+// *BatchError keyed by shard name.
+func (ss *ShardedSet) Refresh(entries []string) error {
+	parts := make(map[*IPSet][]string, len(ss.Shards))
+	for _, entry := range entries {
+		s := ss.Shard(entry)
+		parts[s] = append(parts[s], entry)
+	}
+	var batch BatchError
+	for _, s := range ss.Shards {
+		batch.add(s.Name, s.Refresh(parts[s]))
+	}
+	return batch.err()
+}
+
+// Len returns the number of entries in all shards.
+func (ss *ShardedSet) Len() (int, error) {
+	total := 0
+	for _, s := range ss.Shards {
+		n, err := s.Len()
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Destroy destroys every shard.
+func (ss *ShardedSet) Destroy() error {
+	var batch BatchError
+	for _, s := range ss.Shards {
+		batch.add(s.Name, s.Destroy())
+	}
+	return batch.err()
+}
+
+// Rules returns the iptables arguments appending one rule per shard to
+// chain, matching dir (e.g. "src") against the shard and jumping to target.
+func (ss *ShardedSet) Rules(chain, dir, target string) [][]string {
+	rules := make([][]string, len(ss.Shards))
+	for i, s := range ss.Shards {
+		rules[i] = []string{"-A", chain, "-m", "set", "--match-set", s.Name, dir, "-j", target}
+	}
+	return rules
+}
@@ -0,0 +1,106 @@
+package go_ipset
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SkbMark is the firewall mark an entry of a skbinfo set assigns to
+// matching packets, applied under Mask.
+type SkbMark struct {
+	Value uint32
+	Mask  uint32
+}
+
+// String formats the mark as ipset does, omitting a full mask.
+func (m SkbMark) String() string {
+	if m.Mask == 0xffffffff {
+		return fmt.Sprintf("0x%x", m.Value)
+	}
+	return fmt.Sprintf("0x%x/0x%x", m.Value, m.Mask)
+}
+
+// ParseSkbMark parses a mark written value[/mask]; the mask defaults to
+// 0xffffffff.
+func ParseSkbMark(s string) (SkbMark, error) {
+	v, mask, hasMask := strings.Cut(s, "/")
+	value, err := strconv.ParseUint(v, 0, 32)
+	if err != nil {
+		return SkbMark{}, fmt.Errorf("invalid skbmark %q: value must be a 32-bit number", s)
+	}
+	m := SkbMark{Value: uint32(value), Mask: 0xffffffff}
+	if hasMask {
+		n, err := strconv.ParseUint(mask, 0, 32)
+		if err != nil {
+			return SkbMark{}, fmt.Errorf("invalid skbmark %q: mask must be a 32-bit number", s)
+		}
+		m.Mask = uint32(n)
+	}
+	return m, nil
+}
+
+// SkbPrio is the traffic control class an entry of a skbinfo set assigns
+// to matching packets.
+type SkbPrio struct {
+	Major uint16
+	Minor uint16
+}
+
+// String formats the class as major:minor in hex, as tc and ipset do.
+func (p SkbPrio) String() string {
+	return fmt.Sprintf("%x:%x", p.Major, p.Minor)
+}
+
+// ParseSkbPrio parses a class written major:minor in hex.
+func ParseSkbPrio(s string) (SkbPrio, error) {
+	major, minor, ok := strings.Cut(s, ":")
+	ma, err1 := strconv.ParseUint(major, 16, 16)
+	mi, err2 := strconv.ParseUint(minor, 16, 16)
+	if !ok || err1 != nil || err2 != nil {
+		return SkbPrio{}, fmt.Errorf("invalid skbprio %q: must be major:minor with 16-bit hex numbers", s)
+	}
+	return SkbPrio{Major: uint16(ma), Minor: uint16(mi)}, nil
+}
+
+// ParseSkbQueue parses a hardware queue number.
+func ParseSkbQueue(s string) (uint16, error) {
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid skbqueue %q: must be a 16-bit number", s)
+	}
+	return uint16(n), nil
+}
+
+// setSkb sets the skb option named opt from its listed value. Empty and
+// malformed values are dropped.
+func (e *Entry) setSkb(opt, v string) {
+	switch opt {
+	case "skbmark":
+		if m, err := ParseSkbMark(v); err == nil {
+			e.SkbMark = &m
+		}
+	case "skbprio":
+		if p, err := ParseSkbPrio(v); err == nil {
+			e.SkbPrio = &p
+		}
+	case "skbqueue":
+		if q, err := ParseSkbQueue(v); err == nil {
+			e.SkbQueue = &q
+		}
+	}
+}
+
+// skbStrings formats the skb options of e, empty where unset.
+func (e Entry) skbStrings() (mark, prio, queue string) {
+	if e.SkbMark != nil {
+		mark = e.SkbMark.String()
+	}
+	if e.SkbPrio != nil {
+		prio = e.SkbPrio.String()
+	}
+	if e.SkbQueue != nil {
+		queue = strconv.Itoa(int(*e.SkbQueue))
+	}
+	return mark, prio, queue
+}
@@ -0,0 +1,128 @@
+package go_ipset
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotPrefix = "ipset-"
+	snapshotSuffix = ".save"
+	snapshotLayout = "20060102T150405.000000000Z"
+)
+
+// Retention decides which snapshots PruneSnapshots keeps. A snapshot is
+// kept if it is among the Keep newest or younger than MaxAge; zero values
+// disable the respective rule.
+type Retention struct {
+	Keep   int
+	MaxAge time.Duration
+}
+
+// Snapshot writes the given sets, or every hash set on the host when none
+// are given, to a timestamped save-format file in dir and returns its path.
+// Other set types are left out, as Rollback cannot restore them.
+func Snapshot(dir string, sets ...*IPSet) (string, error) {
+	var buf bytes.Buffer
+	if len(sets) == 0 {
+		var all bytes.Buffer
+		if err := SaveAll(&all); err != nil {
+			return "", err
+		}
+		buf.Write(hashSetsOnly(all.Bytes()))
+	}
+	for _, s := range sets {
+		out, err := s.save()
+		if err != nil {
+			return "", err
+		}
+		buf.Write(out)
+	}
+	name := snapshotPrefix + time.Now().UTC().Format(snapshotLayout) + snapshotSuffix
+	path := filepath.Join(dir, name)
+	if err := writeFileAtomic(path, buf.Bytes(), true); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// hashSetsOnly returns the lines of save output belonging to hash sets.
+func hashSetsOnly(data []byte) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	hash := make(map[string]bool)
+	for _, line := range lines {
+		f := strings.Fields(line)
+		if len(f) >= 3 && f[0] == "create" && strings.HasPrefix(f[2], "hash:") {
+			hash[f[1]] = true
+		}
+	}
+	var b strings.Builder
+	for _, line := range lines {
+		if f := strings.Fields(line); len(f) >= 2 && hash[f[1]] {
+			b.WriteString(line)
+		}
+	}
+	return []byte(b.String())
+}
+
+// Snapshots returns the snapshot files in dir, oldest first.
+func Snapshots(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasPrefix(f.Name(), snapshotPrefix) && strings.HasSuffix(f.Name(), snapshotSuffix) {
+			paths = append(paths, filepath.Join(dir, f.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Rollback restores every set recorded in the snapshot file, creating
+// missing sets and atomically replacing the members of existing ones.
+// Nothing is restored if any set in the file is not supported.
+func Rollback(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := applySnapshot(data); err != nil {
+		return fmt.Errorf("error rolling back %s: %v", path, err)
+	}
+	return nil
+}
+
+// PruneSnapshots removes the snapshots in dir not kept by r.
+func PruneSnapshots(dir string, r Retention) error {
+	if r.Keep == 0 && r.MaxAge == 0 {
+		return nil
+	}
+	paths, err := Snapshots(dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i, path := range paths {
+		if r.Keep > 0 && i >= len(paths)-r.Keep {
+			continue
+		}
+		if r.MaxAge > 0 {
+			name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), snapshotPrefix), snapshotSuffix)
+			if t, err := time.Parse(snapshotLayout, name); err == nil && now.Sub(t) < r.MaxAge {
+				continue
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
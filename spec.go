@@ -0,0 +1,267 @@
+package go_ipset
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SetSpec describes a set and its members as found in a save/restore file.
+type SetSpec struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Family   string `json:"family,omitempty"`
+	HashSize int    `json:"hashsize,omitempty"`
+	MaxElem  int    `json:"maxelem,omitempty"`
+	Timeout  int    `json:"timeout,omitempty"`
+	Counters bool   `json:"counters,omitempty"`
+	Comment  bool   `json:"comment,omitempty"`
+
+	// TimeoutExt marks a set created with the timeout extension even
+	// though its default timeout is 0.
+	TimeoutExt bool `json:"timeoutext,omitempty"`
+
+	// Extra holds create options not covered by the fields above, such as
+	// netmask or skbinfo, in the order they appeared.
+	Extra []string `json:"extra,omitempty"`
+
+	Entries []Entry `json:"entries,omitempty"`
+}
+
+// ApplySpec creates the set described by sp if needed and atomically
+// replaces its members with sp.Entries.
+func ApplySpec(sp *SetSpec) (*IPSet, error) {
+	s, err := sp.handle()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.create(s.Name); err != nil {
+		return nil, err
+	}
+	if err := s.refresh(sp.Entries); err != nil {
+		return nil, err
+	}
+	s.desired = sp.Entries
+	return s, nil
+}
+
+// handle returns an IPSet for the spec without touching the kernel.
+func (sp *SetSpec) handle() (*IPSet, error) {
+	s, err := New(sp.Name, sp.Type, &Params{
+		HashFamily:       sp.Family,
+		HashSize:         sp.HashSize,
+		MaxElem:          sp.MaxElem,
+		Timeout:          sp.Timeout,
+		Comment:          sp.Comment,
+		Counters:         sp.Counters,
+		TimeoutExt:       sp.TimeoutExt,
+		AllowUnknownType: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.extra = sp.Extra
+	return s, nil
+}
+
+// Spec returns the header of the set as known to the handle together with
+// the members currently in the kernel.
+func (s *IPSet) Spec() (*SetSpec, error) {
+	entries, err := s.entries()
+	if err != nil {
+		return nil, err
+	}
+	return &SetSpec{
+		Name:       s.Name,
+		Type:       s.HashType,
+		Family:     s.HashFamily,
+		HashSize:   s.HashSize,
+		MaxElem:    s.MaxElem,
+		Timeout:    s.Timeout,
+		Counters:   s.Counters,
+		Comment:    s.Comment,
+		TimeoutExt: s.TimeoutExt,
+		Extra:      s.extra,
+		Entries:    entries,
+	}, nil
+}
+
+// MarshalJSON encodes the set as a SetSpec, including its live members.
+func (s *IPSet) MarshalJSON() ([]byte, error) {
+	sp, err := s.Spec()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sp)
+}
+
+// UnmarshalJSON restores a handle from a SetSpec encoding. The kernel is
+// not touched; the decoded members are kept as the desired content.
+func (s *IPSet) UnmarshalJSON(data []byte) error {
+	var sp SetSpec
+	if err := json.Unmarshal(data, &sp); err != nil {
+		return err
+	}
+	h, err := sp.handle()
+	if err != nil {
+		return err
+	}
+	*s = IPSet{
+		Name:       h.Name,
+		HashType:   h.HashType,
+		HashFamily: h.HashFamily,
+		HashSize:   h.HashSize,
+		MaxElem:    h.MaxElem,
+		Timeout:    h.Timeout,
+		Comment:    h.Comment,
+		Counters:   h.Counters,
+		TimeoutExt: h.TimeoutExt,
+		extra:      h.extra,
+		desired:    sp.Entries,
+	}
+	return nil
+}
+
+// ParseRestore reads the ipset save/restore format from r. Sets are returned
+// in the order they are first mentioned; adds to a set without a create line
+// yield a spec with an empty Type.
+func ParseRestore(r io.Reader) ([]SetSpec, error) {
+	var (
+		specs []SetSpec
+		index = make(map[string]int)
+	)
+	spec := func(name string) *SetSpec {
+		i, ok := index[name]
+		if !ok {
+			i = len(specs)
+			index[name] = i
+			specs = append(specs, SetSpec{Name: name})
+		}
+		return &specs[i]
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		fields := splitFields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") || fields[0] == "COMMIT" {
+			continue
+		}
+		switch fields[0] {
+		case "create", "-N":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("line %d: create needs a name and a type", n)
+			}
+			sp := spec(fields[1])
+			sp.Type = fields[2]
+			if err := sp.parseCreateOptions(fields[3:]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+		case "add", "-A":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("line %d: add needs a name and an entry", n)
+			}
+			sp := spec(fields[1])
+			sp.Entries = append(sp.Entries, parseEntry(fields[2], fields[3:]))
+		default:
+			return nil, fmt.Errorf("line %d: unsupported command %s", n, fields[0])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+func (sp *SetSpec) parseCreateOptions(opts []string) error {
+	for i := 0; i < len(opts); i++ {
+		var err error
+		switch opts[i] {
+		case "counters":
+			sp.Counters = true
+			continue
+		case "comment":
+			sp.Comment = true
+			continue
+		case "family", "hashsize", "maxelem", "timeout":
+			if i+1 == len(opts) {
+				return fmt.Errorf("missing value for %s", opts[i])
+			}
+		default:
+			sp.Extra = append(sp.Extra, opts[i])
+			continue
+		}
+		v := opts[i+1]
+		switch opts[i] {
+		case "family":
+			sp.Family = v
+		case "hashsize":
+			sp.HashSize, err = strconv.Atoi(v)
+		case "maxelem":
+			sp.MaxElem, err = strconv.Atoi(v)
+		case "timeout":
+			sp.Timeout, err = strconv.Atoi(v)
+			sp.TimeoutExt = true
+		}
+		if err != nil {
+			return fmt.Errorf("bad value for %s: %s", opts[i], v)
+		}
+		i++
+	}
+	return nil
+}
+
+// createArgs renders the create options of the spec as ipset arguments.
+func (sp *SetSpec) createArgs() []string {
+	var args []string
+	if sp.Family != "" {
+		args = append(args, "family", sp.Family)
+	}
+	if sp.HashSize > 0 {
+		args = append(args, "hashsize", strconv.Itoa(sp.HashSize))
+	}
+	if sp.MaxElem > 0 {
+		args = append(args, "maxelem", strconv.Itoa(sp.MaxElem))
+	}
+	if sp.Timeout > 0 || sp.TimeoutExt {
+		args = append(args, "timeout", strconv.Itoa(sp.Timeout))
+	}
+	if sp.Counters {
+		args = append(args, "counters")
+	}
+	if sp.Comment {
+		args = append(args, "comment")
+	}
+	return append(args, sp.Extra...)
+}
+
+// WriteRestore writes specs to w in the format read by ParseRestore and
+// ipset restore. Specs without a Type only get their add lines.
+func WriteRestore(w io.Writer, specs []SetSpec) error {
+	bw := bufio.NewWriter(w)
+	for i := range specs {
+		sp := &specs[i]
+		if sp.Type != "" {
+			fmt.Fprintln(bw, strings.Join(append([]string{"create", sp.Name, sp.Type}, sp.createArgs()...), " "))
+		}
+		for _, e := range sp.Entries {
+			fmt.Fprintln(bw, addLine(sp.Name, e))
+		}
+	}
+	return bw.Flush()
+}
+
+// addLine renders e as a restore-format add line for set name, quoting the
+// comment.
+func addLine(name string, e Entry) string {
+	args := append([]string{"add", name, e.Value}, e.args()...)
+	for i := 4; i < len(args); i++ {
+		if args[i-1] == "comment" {
+			args[i] = `"` + args[i] + `"`
+			break
+		}
+	}
+	return strings.Join(args, " ")
+}
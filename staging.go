@@ -0,0 +1,80 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync/atomic"
+)
+
+// Staging names the temporary set a set is loaded into by Refresh, the set
+// operations and CloneTo before it is swapped or renamed into place.
+type Staging func(set string) string
+
+// StagingSuffix names staging sets by appending suffix to the set name;
+// the default is StagingSuffix("-temp").
+func StagingSuffix(suffix string) Staging {
+	return func(set string) string {
+		return set + suffix
+	}
+}
+
+// StagingHash names staging sets "stg-" followed by a hash of the set name,
+// which fits the name limit whatever the length of the set name.
+func StagingHash() Staging {
+	return func(set string) string {
+		h := fnv.New32a()
+		h.Write([]byte(set))
+		return fmt.Sprintf("stg-%08x", h.Sum32())
+	}
+}
+
+// StagingCounter names staging sets by appending a dash and a number
+// counting up with every staging set named by the returned Staging.
+func StagingCounter() Staging {
+	var n atomic.Uint64
+	return func(set string) string {
+		return set + "-" + strconv.FormatUint(n.Add(1), 10)
+	}
+}
+
+// ErrStagingExists is returned when the staging set of a set exists already
+// and no Locker guarantees that it is a leftover rather than the staging
+// set of another process.
+var ErrStagingExists = errors.New("staging set exists")
+
+// stagingName returns the name of the staging set of the set name. With a
+// Locker, a set of that name can only be left over from an interrupted run,
+// as staging happens with the locks of the set held, so it is destroyed and
+// reported as a warning. Without one it may belong to another process
+// refreshing the set, so it is left alone and ErrStagingExists returned.
+func (s *IPSet) stagingName(name string) (string, error) {
+	staging := s.Staging
+	if staging == nil {
+		staging = StagingSuffix("-temp")
+	}
+	tmp := staging(name)
+	if tmp == name {
+		return "", fmt.Errorf("staging name of set %s is the set name", name)
+	}
+	if err := ValidName(tmp); err != nil {
+		return "", fmt.Errorf("invalid staging name for set %s: %v", name, err)
+	}
+	if activePlan(s.DryRun) != nil {
+		return tmp, nil
+	}
+	exists, err := setExists(tmp)
+	if err != nil || !exists {
+		return tmp, err
+	}
+	if activeLocker(s.Locker) == nil {
+		return "", fmt.Errorf("%w: %s, for set %s; destroy it if it is left over, or set a Locker", ErrStagingExists, tmp, name)
+	}
+	if err := destroyIPSet(s.DryRun, tmp); err != nil {
+		return "", err
+	}
+	cmd := []string{"destroy", tmp}
+	s.notifyWarnings(warnings(cmd, []byte("took over staging set "+tmp+" left by an earlier run")))
+	return tmp, nil
+}
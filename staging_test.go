@@ -0,0 +1,48 @@
+package go_ipset
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// failingSwapBackend fails the first swap it is asked to run.
+type failingSwapBackend struct {
+	Backend
+	failed bool
+}
+
+func (b *failingSwapBackend) Run(stdin io.Reader, args ...string) ([]byte, []byte, error) {
+	if len(args) > 0 && args[0] == "swap" && !b.failed {
+		b.failed = true
+		return nil, []byte("swap failed"), errors.New("exit status 1")
+	}
+	return b.Backend.Run(stdin, args...)
+}
+
+func TestRefreshAfterFailedSwap(t *testing.T) {
+	s := newFakeSet(t, "swapfail")
+	b := &failingSwapBackend{Backend: FakeBackend()}
+	SetBackend(b)
+	if _, err := New("swapfail", TypeHashIP, &Params{Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Refresh([]string{"192.0.2.1"}); err == nil {
+		t.Fatal("Refresh succeeded despite the failing swap")
+	}
+	names, err := ListNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if name == "swapfail-temp" {
+			t.Fatal("staging set left behind after the failed swap")
+		}
+	}
+	if err := s.Refresh([]string{"192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Test("192.0.2.1"); err != nil || !ok {
+		t.Errorf("192.0.2.1 missing after refresh: %v", err)
+	}
+}
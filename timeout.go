@@ -0,0 +1,37 @@
+package go_ipset
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxTimeout is the longest timeout ipset accepts, for sets and entries.
+const MaxTimeout = 2147483 * time.Second
+
+// ErrInvalidTimeout is returned for timeouts outside 0 to MaxTimeout.
+var ErrInvalidTimeout = errors.New("invalid timeout")
+
+// checkTimeout rejects timeouts the kernel would refuse.
+func checkTimeout(d time.Duration) error {
+	if d < 0 || d > MaxTimeout {
+		return fmt.Errorf("%w: %v is outside 0 to %d seconds", ErrInvalidTimeout, d, int(MaxTimeout/time.Second))
+	}
+	return nil
+}
+
+// timeoutSeconds converts d to the whole seconds ipset takes, rounding a
+// partial second up, so that a short timeout does not turn into 0, which
+// means never expire.
+func timeoutSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// NeverExpire makes Add add the entry with timeout 0, which keeps it in a
+// set with the timeout extension until it is deleted, whatever the default
+// timeout of the set, also through a handle not told about the extension.
+func NeverExpire() AddOption {
+	return func(e *Entry) {
+		e.Permanent = true
+	}
+}
@@ -0,0 +1,209 @@
+package go_ipset
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+// EntryType is implemented by the typed entries of a TypedSet, one per set
+// type, so that a set only accepts entries of its shape.
+type EntryType interface {
+	// setType returns the type of the sets holding such entries.
+	setType() string
+	// String formats the entry as ipset expects it.
+	String() string
+}
+
+// IPEntry is an entry of a hash:ip set.
+type IPEntry struct {
+	Addr netip.Addr
+}
+
+// MACEntry is an entry of a hash:mac set.
+type MACEntry struct {
+	MAC net.HardwareAddr
+}
+
+// IPMACEntry is an entry of a hash:ip,mac set.
+type IPMACEntry struct {
+	Addr netip.Addr
+	MAC  net.HardwareAddr
+}
+
+// IPMarkEntry is an entry of a hash:ip,mark set.
+type IPMarkEntry struct {
+	Addr netip.Addr
+	Mark uint32
+}
+
+// IPPortEntry is an entry of a hash:ip,port set. An empty Proto means tcp.
+type IPPortEntry struct {
+	Addr  netip.Addr
+	Proto string
+	Port  uint16
+}
+
+// IPPortIPEntry is an entry of a hash:ip,port,ip set.
+type IPPortIPEntry struct {
+	Addr  netip.Addr
+	Proto string
+	Port  uint16
+	Addr2 netip.Addr
+}
+
+// IPPortNetEntry is an entry of a hash:ip,port,net set.
+type IPPortNetEntry struct {
+	Addr   netip.Addr
+	Proto  string
+	Port   uint16
+	Prefix netip.Prefix
+}
+
+// NetEntry is an entry of a hash:net set.
+type NetEntry struct {
+	Prefix netip.Prefix
+}
+
+// NetNetEntry is an entry of a hash:net,net set.
+type NetNetEntry struct {
+	Prefix  netip.Prefix
+	Prefix2 netip.Prefix
+}
+
+// NetPortEntry is an entry of a hash:net,port set.
+type NetPortEntry struct {
+	Prefix netip.Prefix
+	Proto  string
+	Port   uint16
+}
+
+// NetPortNetEntry is an entry of a hash:net,port,net set.
+type NetPortNetEntry struct {
+	Prefix  netip.Prefix
+	Proto   string
+	Port    uint16
+	Prefix2 netip.Prefix
+}
+
+// NetIfaceEntry is an entry of a hash:net,iface set.
+type NetIfaceEntry struct {
+	Prefix netip.Prefix
+	Iface  string
+}
+
+func portValue(proto string, port uint16) string {
+	if proto == "" {
+		proto = "tcp"
+	}
+	return proto + ":" + strconv.Itoa(int(port))
+}
+
+func (IPEntry) setType() string         { return TypeHashIP }
+func (MACEntry) setType() string        { return TypeHashMAC }
+func (IPMACEntry) setType() string      { return TypeHashIPMAC }
+func (IPMarkEntry) setType() string     { return TypeHashIPMark }
+func (IPPortEntry) setType() string     { return TypeHashIPPort }
+func (IPPortIPEntry) setType() string   { return TypeHashIPPortIP }
+func (IPPortNetEntry) setType() string  { return TypeHashIPPortNet }
+func (NetEntry) setType() string        { return TypeHashNet }
+func (NetNetEntry) setType() string     { return TypeHashNetNet }
+func (NetPortEntry) setType() string    { return TypeHashNetPort }
+func (NetPortNetEntry) setType() string { return TypeHashNetPortNet }
+func (NetIfaceEntry) setType() string   { return TypeHashNetIface }
+
+func (e IPEntry) String() string {
+	return addrValue(e.Addr)
+}
+
+func (e MACEntry) String() string {
+	return e.MAC.String()
+}
+
+func (e IPMACEntry) String() string {
+	return addrValue(e.Addr) + "," + e.MAC.String()
+}
+
+func (e IPMarkEntry) String() string {
+	return addrValue(e.Addr) + ",0x" + strconv.FormatUint(uint64(e.Mark), 16)
+}
+
+func (e IPPortEntry) String() string {
+	return addrValue(e.Addr) + "," + portValue(e.Proto, e.Port)
+}
+
+func (e IPPortIPEntry) String() string {
+	return addrValue(e.Addr) + "," + portValue(e.Proto, e.Port) + "," + addrValue(e.Addr2)
+}
+
+func (e IPPortNetEntry) String() string {
+	return addrValue(e.Addr) + "," + portValue(e.Proto, e.Port) + "," + prefixValue(e.Prefix)
+}
+
+func (e NetEntry) String() string {
+	return prefixValue(e.Prefix)
+}
+
+func (e NetNetEntry) String() string {
+	return prefixValue(e.Prefix) + "," + prefixValue(e.Prefix2)
+}
+
+func (e NetPortEntry) String() string {
+	return prefixValue(e.Prefix) + "," + portValue(e.Proto, e.Port)
+}
+
+func (e NetPortNetEntry) String() string {
+	return prefixValue(e.Prefix) + "," + portValue(e.Proto, e.Port) + "," + prefixValue(e.Prefix2)
+}
+
+func (e NetIfaceEntry) String() string {
+	return prefixValue(e.Prefix) + "," + e.Iface
+}
+
+// TypedSet is a set whose Add, Del, Test and Refresh only take entries of
+// the shape matching its type, e.g. TypedSet[IPPortEntry] for a
+// hash:ip,port set.
+type TypedSet[E EntryType] struct {
+	set *IPSet
+}
+
+// NewTyped returns a handle for the named set of the type matching E,
+// configured by opts as with New.
+func NewTyped[E EntryType](name string, opts ...Option) (*TypedSet[E], error) {
+	var e E
+	s, err := New(name, e.setType(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedSet[E]{set: s}, nil
+}
+
+// Set returns the untyped handle of the set.
+func (t *TypedSet[E]) Set() *IPSet {
+	return t.set
+}
+
+// Add adds e to the set, as IPSet.Add does.
+func (t *TypedSet[E]) Add(e E, timeout int) error {
+	return t.set.Add(e.String(), timeout)
+}
+
+// Del deletes e from the set.
+func (t *TypedSet[E]) Del(e E) error {
+	return t.set.Del(e.String())
+}
+
+// Test reports whether e is in the set.
+func (t *TypedSet[E]) Test(e E) (bool, error) {
+	return t.set.Test(e.String())
+}
+
+// Refresh replaces the content of the set with entries, as IPSet.Refresh
+// does.
+func (t *TypedSet[E]) Refresh(entries []E) error {
+	values := make([]string, len(entries))
+	for i, e := range entries {
+		values[i] = e.String()
+	}
+	return t.set.Refresh(values)
+}
@@ -0,0 +1,43 @@
+package go_ipset
+
+// Hash set types understood by ipset.
+const (
+	TypeHashIP         = "hash:ip"
+	TypeHashMAC        = "hash:mac"
+	TypeHashIPMAC      = "hash:ip,mac"
+	TypeHashIPMark     = "hash:ip,mark"
+	TypeHashIPPort     = "hash:ip,port"
+	TypeHashIPPortIP   = "hash:ip,port,ip"
+	TypeHashIPPortNet  = "hash:ip,port,net"
+	TypeHashNet        = "hash:net"
+	TypeHashNetNet     = "hash:net,net"
+	TypeHashNetPort    = "hash:net,port"
+	TypeHashNetPortNet = "hash:net,port,net"
+	TypeHashNetIface   = "hash:net,iface"
+)
+
+// Address families of hash sets.
+const (
+	FamilyInet  = "inet"
+	FamilyInet6 = "inet6"
+)
+
+var knownTypes = map[string]bool{
+	TypeHashIP:         true,
+	TypeHashMAC:        true,
+	TypeHashIPMAC:      true,
+	TypeHashIPMark:     true,
+	TypeHashIPPort:     true,
+	TypeHashIPPortIP:   true,
+	TypeHashIPPortNet:  true,
+	TypeHashNet:        true,
+	TypeHashNetNet:     true,
+	TypeHashNetPort:    true,
+	TypeHashNetPortNet: true,
+	TypeHashNetIface:   true,
+}
+
+var knownFamilies = map[string]bool{
+	FamilyInet:  true,
+	FamilyInet6: true,
+}
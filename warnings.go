@@ -0,0 +1,66 @@
+package go_ipset
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	warningMu      sync.Mutex
+	warningHandler func(cmd []string, warning string)
+)
+
+// SetWarningHandler makes the package pass fn the warnings ipset prints
+// for commands that still succeed, e.g. adjusted create options, together
+// with the command that caused them. A nil fn discards them again.
+func SetWarningHandler(fn func(cmd []string, warning string)) {
+	warningMu.Lock()
+	warningHandler = fn
+	warningMu.Unlock()
+}
+
+// OnWarning registers fn to be called with the warnings of the commands
+// changing the set through this handle.
+func (s *IPSet) OnWarning(fn func(warning string)) {
+	s.mu.Lock()
+	s.onWarning = append(s.onWarning, fn)
+	s.mu.Unlock()
+}
+
+// notifyWarnings passes ws to the warning hooks of s.
+func (s *IPSet) notifyWarnings(ws []string) {
+	if len(ws) == 0 {
+		return
+	}
+	s.mu.Lock()
+	onWarning := s.onWarning
+	s.mu.Unlock()
+	for _, w := range ws {
+		for _, fn := range onWarning {
+			fn(w)
+		}
+	}
+}
+
+var warningPrefix = regexp.MustCompile(`^ipset( v[\d.]+)?: `)
+
+// warnings returns the lines ipset printed to stderr for a successful
+// command and passes them to the warning handler.
+func warnings(cmd []string, stderr []byte) []string {
+	warningMu.Lock()
+	handler := warningHandler
+	warningMu.Unlock()
+	var ws []string
+	for _, line := range strings.Split(string(stderr), "\n") {
+		line = strings.TrimSpace(warningPrefix.ReplaceAllString(line, ""))
+		if line == "" {
+			continue
+		}
+		ws = append(ws, line)
+		if handler != nil {
+			handler(cmd, line)
+		}
+	}
+	return ws
+}
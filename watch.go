@@ -0,0 +1,66 @@
+package go_ipset
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ExpiryWatcher polls a set and reports entries that disappeared since the
+// previous poll, whether they expired or were deleted, together with the
+// last metadata seen for them. They are also published as EntryExpired
+// events.
+type ExpiryWatcher struct {
+	Set      *IPSet
+	Interval time.Duration
+	// OnGone is called for every entry that left the set; it may be nil,
+	// e.g. when only the events are of interest.
+	OnGone func(last Entry)
+	// OnError receives listing errors; it may be nil.
+	OnError func(error)
+
+	seen map[string]Entry
+}
+
+// Run polls the set every Interval, which must be positive, until ctx is
+// done. The first poll only records the current content.
+func (w *ExpiryWatcher) Run(ctx context.Context) error {
+	if w.Interval <= 0 {
+		return fmt.Errorf("expiry watcher of set %s: Interval %v is not positive", w.Set.Name, w.Interval)
+	}
+	t := time.NewTicker(w.Interval)
+	defer t.Stop()
+	for {
+		if err := w.Poll(); err != nil && w.OnError != nil {
+			w.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Poll lists the set once and calls OnGone for entries missing since the
+// last Poll.
+func (w *ExpiryWatcher) Poll() error {
+	entries, err := w.Set.entries()
+	if err != nil {
+		return err
+	}
+	cur := make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		cur[e.Value] = e
+	}
+	for v, e := range w.seen {
+		if _, ok := cur[v]; !ok {
+			publish(Event{Type: EntryExpired, Set: w.Set.Name, Entry: v})
+			if w.OnGone != nil {
+				w.OnGone(e)
+			}
+		}
+	}
+	w.seen = cur
+	return nil
+}